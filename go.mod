@@ -1,8 +1,10 @@
 module github.com/vmw-pso/back-end
 
-go 1.19
+go 1.21
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.7
 )
+
+require gopkg.in/yaml.v3 v3.0.1
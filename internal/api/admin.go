@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+func (api *API) handleListJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Status string
+			Kind   string
+			data.Filters
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Status = api.readString(qs, "status", "")
+		input.Kind = api.readString(qs, "kind", "")
+		input.Filters.Page = api.readInt(qs, "page", 1, v)
+		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
+		input.Filters.Sort = api.readString(qs, "sort", "-job_id")
+		input.Filters.SortSafelist = []string{"job_id", "run_at", "updated_at", "-job_id", "-run_at", "-updated_at"}
+
+		data.ValidateJobStatus(v, input.Status)
+		if data.ValidateFilters(v, input.Filters); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		if api.wantsCSV(r) {
+			err := writeCSVList(api, w, r, "jobs", input.Filters, func(f data.Filters) ([]*data.Job, data.Metadata, error) {
+				return api.models.Jobs.GetAll(input.Status, input.Kind, f)
+			})
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		jobs, metadata, err := api.models.Jobs.GetAll(input.Status, input.Kind, input.Filters)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		counts, err := api.models.Jobs.CountByStatus()
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"jobs": jobs, "counts": counts, "metadata": metadata}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleShowJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		job, err := api.models.Jobs.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"job": job}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleRetryJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		job, err := api.models.Jobs.Retry(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrEditConflict):
+				api.jobNotRetryableResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusAccepted, envelope{"job": job}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const changepointFetchTimeout = time.Minute
+
+var changepointClient = &http.Client{Timeout: changepointFetchTimeout}
+
+// registerChangepointJobs schedules a sync from the configured ChangePoint
+// export, if there is one.
+func (api *API) registerChangepointJobs() error {
+	registerJob(api, "changepoint.sync", func(ctx context.Context, _ struct{}) error {
+		s, err := api.syncChangepoint(ctx, api.cfg.Changepoint.Source)
+		if err != nil {
+			return err
+		}
+
+		api.logger.PrintInfo("synced projects from changepoint", map[string]any{
+			"sync_id":   s.ID,
+			"rows":      s.Rows,
+			"updated":   s.Updated,
+			"flagged":   s.Flagged,
+			"unmatched": s.Unmatched,
+		})
+		return nil
+	})
+
+	if api.cfg.Changepoint.Source == "" {
+		return nil
+	}
+
+	return api.scheduleJob(api.cfg.Changepoint.Schedule, "changepoint.sync")
+}
+
+// SyncChangepoint syncs projects from a ChangePoint export outside the
+// server, for the CLI.
+func (api *API) SyncChangepoint(source string) (*data.ChangepointSync, error) {
+	db, err := openDB(api.cfg.DB.DSN, api.cfg.DB.MaxOpenConns, api.cfg.DB.MaxIdleConns, api.cfg.DB.MaxIdleTime)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	api.db = db
+	api.models = *data.NewModels(db)
+
+	return api.syncChangepoint(context.Background(), source)
+}
+
+func (api *API) syncChangepoint(ctx context.Context, source string) (*data.ChangepointSync, error) {
+	rows, err := readChangepointSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.models.Changepoint.Sync(changepointSourceName(source), rows)
+}
+
+// readChangepointSource reads an export from a file, or from an http(s)
+// URL standing in for the ChangePoint API. The format is taken from the
+// response's content type or else the file extension: .json for JSON and
+// anything else for CSV.
+func readChangepointSource(ctx context.Context, source string) ([]data.ChangepointRow, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		body, err := readChangepointExport(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseChangepointExport(body, changepointFormat("", source))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, changepointFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/csv, application/json")
+	req.Header.Set("User-Agent", "pso-changepoint-sync/"+version)
+
+	res, err := changepointClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching changepoint export: %s", res.Status)
+	}
+
+	body, err := readChangepointExport(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChangepointExport(body, changepointFormat(res.Header.Get("Content-Type"), req.URL.Path))
+}
+
+// readChangepointExport reads a whole export of up to importMaxBytes. It
+// reads one byte past the limit so that a larger export fails, rather than
+// being cut short and leaving a shortened value in its last row.
+func readChangepointExport(r io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(io.LimitReader(r, importMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > importMaxBytes {
+		return nil, fmt.Errorf("%w: export must not be larger than 10MB", data.ErrInvalidImport)
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+func changepointFormat(contentType, name string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json":
+		return "json"
+	case mediaType == "text/csv":
+		return "csv"
+	case strings.EqualFold(path.Ext(name), ".json"):
+		return "json"
+	default:
+		return "csv"
+	}
+}
+
+func parseChangepointExport(r io.Reader, format string) ([]data.ChangepointRow, error) {
+	if format == "json" {
+		return data.ParseChangepointJSON(r)
+	}
+	return data.ParseChangepointCSV(r)
+}
+
+// changepointSourceName is the source recorded against a sync. The query
+// and any credentials are left out of URLs, as they may hold tokens.
+func changepointSourceName(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return source
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// handleCreateChangepointSync syncs projects from a ChangePoint export
+// uploaded as text/csv or application/json.
+func (api *API) handleCreateChangepointSync() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "text/csv" && mediaType != "application/json" {
+			api.badRequestResponse(w, r, errors.New("body must be a text/csv or application/json changepoint export"))
+			return
+		}
+
+		rows, err := parseChangepointExport(http.MaxBytesReader(w, r.Body, importMaxBytes), changepointFormat(mediaType, ""))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesError):
+				api.badRequestResponse(w, r, errors.New("body must not be larger than 10MB"))
+			case errors.Is(err, data.ErrInvalidImport):
+				api.badRequestResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		s, err := api.models.Changepoint.Sync("upload", rows)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/changepoint/syncs/%d", s.ID))
+
+		err = api.writeJSON(w, http.StatusCreated, envelope{"sync": s}, headers)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleShowChangepointSync() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		s, err := api.models.Changepoint.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"sync": s}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleListProjectSyncHistory lists what ChangePoint syncs have done to a
+// project, newest first.
+func (api *API) handleListProjectSyncHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, err := api.models.Projects.Get(api.readIDStringParam(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		var filters data.Filters
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		filters.Page = api.readInt(qs, "page", 1, v)
+		filters.PageSize = api.readInt(qs, "pageSize", 20, v)
+		filters.Sort = "-entry_id"
+		filters.SortSafelist = []string{"-entry_id"}
+
+		if data.ValidateFilters(v, filters); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		entries, metadata, err := api.models.Changepoint.GetProjectHistory(project.OpportunityID, filters)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"history": entries, "metadata": metadata}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleListChangepointFlags lists ChangePoint values flagged for review,
+// by default those still pending.
+func (api *API) handleListChangepointFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Project string
+			Status  string
+			data.Filters
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Project = api.readString(qs, "project", "")
+		input.Status = api.readString(qs, "status", data.ProjectSyncFlagPending)
+		input.Filters.Page = api.readInt(qs, "page", 1, v)
+		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
+		input.Filters.Sort = api.readString(qs, "sort", "flag_id")
+		input.Filters.SortSafelist = []string{"flag_id", "created_at", "-flag_id", "-created_at"}
+
+		data.ValidateProjectSyncFlagStatus(v, input.Status)
+		if data.ValidateFilters(v, input.Filters); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		flags, metadata, err := api.models.Changepoint.GetFlags(input.Project, input.Status, input.Filters)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"flags": flags, "metadata": metadata}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleResolveChangepointFlag accepts a flagged ChangePoint value, writing
+// it to the project, or rejects it, keeping the project as it is.
+func (api *API) handleResolveChangepointFlag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		var input struct {
+			Decision string `json:"decision"`
+		}
+
+		err = api.readJSON(w, r, &input)
+		if err != nil {
+			api.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		v.CheckCode(validator.PermittedValue(input.Decision, "accept", "reject"), "decision", validator.CodeNotPermitted, "must be one of [accept, reject]")
+		if !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		_, err = api.models.Changepoint.GetFlag(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		flag, err := api.models.Changepoint.ResolveFlag(id, input.Decision == "accept")
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				api.editConflictResponse(w, r)
+			case errors.Is(err, data.ErrFlagNotApplicable):
+				v.AddErrorCode("decision", validator.CodeNotPermitted, err.Error())
+				api.failedValidationResponse(w, r, v)
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"flag": flag}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
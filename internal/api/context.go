@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo is attached to every request by assignRequestID and filled in
+// as the request moves through the router.
+type requestInfo struct {
+	id    string
+	route string
+}
+
+func (api *API) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+func (api *API) contextGetRequestInfo(r *http.Request) *requestInfo {
+	info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	if !ok {
+		return &requestInfo{}
+	}
+	return info
+}
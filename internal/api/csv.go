@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/data"
+)
+
+const (
+	csvExportPageSize    = 500
+	csvExportMaxRows     = 50000
+	csvExportPageTimeout = 30 * time.Second
+)
+
+// wantsCSV reports whether the client asked for a list as CSV, with
+// ?format=csv or an Accept header naming text/csv.
+func (api *API) wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "text/csv" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// csvColumn is a field of a record written as CSV, found by index path so
+// that nested structs such as data.Ref are flattened to "manager.id" and
+// "manager.name".
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// csvColumns lists the columns for records of type t in field order, named
+// after their JSON keys. Fields tagged csv:"-" and slices of anything other
+// than strings, such as nested child records, are left out.
+func csvColumns(t reflect.Type, prefix string, index []int) []csvColumn {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var columns []csvColumn
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("csv") == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		path := append(append([]int{}, index...), i)
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case sf.Anonymous && ft.Kind() == reflect.Struct:
+			columns = append(columns, csvColumns(ft, prefix, path)...)
+		case ft == timeType || ft == rawMessageType:
+			columns = append(columns, csvColumn{name: prefix + name, index: path})
+		case ft.Kind() == reflect.Struct:
+			columns = append(columns, csvColumns(ft, prefix+name+".", path)...)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.String:
+			continue
+		case ft.Kind() == reflect.Map || ft.Kind() == reflect.Interface:
+			continue
+		default:
+			columns = append(columns, csvColumn{name: prefix + name, index: path})
+		}
+	}
+
+	return columns
+}
+
+// csvValue formats the field at index in rv. Text that a spreadsheet would
+// treat as a formula is prefixed with a quote.
+func csvValue(rv reflect.Value, index []int) string {
+	for _, i := range index {
+		for rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return ""
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(i)
+	}
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+
+	switch {
+	case rv.Type() == timeType:
+		t := rv.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	case rv.Type() == rawMessageType:
+		return csvText(string(rv.Bytes()))
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return csvText(rv.String())
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64)
+	case reflect.Slice:
+		values := make([]string, rv.Len())
+		for i := range values {
+			values[i] = rv.Index(i).String()
+		}
+		return csvText(strings.Join(values, "; "))
+	default:
+		return csvText(fmt.Sprint(rv.Interface()))
+	}
+}
+
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeCSVList is the CSV counterpart of writeJSON for list endpoints. It
+// streams every record the request matches, ignoring the requested page
+// size: fetch is called for successive pages, following keyset cursors or
+// page numbers as the model supports, until the records run out or
+// csvExportMaxRows have been written. The write deadline is extended for
+// each page, and an X-Export-Truncated trailer says whether the export
+// stopped short of the last record. An error before anything has been
+// written is returned for the caller to report; later errors are logged.
+func writeCSVList[T any](api *API, w http.ResponseWriter, r *http.Request, filename string, filters data.Filters,
+	fetch func(data.Filters) ([]T, data.Metadata, error)) error {
+
+	filters.Page = 1
+	filters.PageSize = csvExportPageSize
+	filters.Before = nil
+	filters.SkipCount = true
+
+	records, metadata, err := fetch(filters)
+	if err != nil {
+		return err
+	}
+
+	// The header row comes from the record type, so the columns are the
+	// same even when there are no records.
+	columns := csvColumns(reflect.TypeOf((*T)(nil)).Elem(), "", nil)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + ".csv"}))
+	w.Header().Set("X-Export-Limit", strconv.Itoa(csvExportMaxRows))
+	w.Header().Set("Trailer", "X-Export-Truncated")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+
+	truncated := true
+	defer func() {
+		w.Header().Set("X-Export-Truncated", strconv.FormatBool(truncated))
+	}()
+
+	written := 0
+	for {
+		err := rc.SetWriteDeadline(time.Now().Add(csvExportPageTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			api.errorLog(r, err)
+			return nil
+		}
+
+		for _, record := range records {
+			if written == csvExportMaxRows {
+				api.requestLogger(r).PrintWarn("csv export truncated", map[string]any{"rows": written})
+				return nil
+			}
+
+			row := make([]string, len(columns))
+			for i, c := range columns {
+				row[i] = csvValue(reflect.ValueOf(record), c.index)
+			}
+			cw.Write(row)
+			written++
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return nil
+		}
+		rc.Flush()
+
+		switch {
+		case metadata.NextCursor != nil:
+			filters.After = metadata.NextCursor
+		case filters.After == nil && filters.Page < metadata.LastPage:
+			filters.Page++
+		default:
+			truncated = false
+			return nil
+		}
+
+		records, metadata, err = fetch(filters)
+		if err != nil {
+			api.errorLog(r, err)
+			return nil
+		}
+	}
+}
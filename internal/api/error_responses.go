@@ -1,17 +1,82 @@
 package api
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// problem is an RFC 7807 problem details body. It is only sent to clients
+// that ask for application/problem+json; everyone else gets the original
+// {"error": ...} envelope.
+type problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Errors   []problemField `json:"errors,omitempty"`
+}
+
+type problemField struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	key     string
+}
+
+func fieldProblems(errs []validator.FieldError) []problemField {
+	fields := make([]problemField, len(errs))
+	for i, e := range errs {
+		fields[i] = problemField{Field: e.Pointer(), Code: e.Code, Message: e.Message, key: e.Key()}
+	}
+	return fields
+}
 
 func (api *API) errorLog(r *http.Request, err error) {
-	api.logger.PrintError(err, map[string]string{
-		"request-method": r.Method,
-		"request_urL":    r.URL.String(),
+	api.requestLogger(r).PrintError(err, map[string]any{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
 	})
 }
 
-func (api *API) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
-	err := api.writeJSON(w, status, env, nil)
+func (api *API) wantsProblemJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/problem+json")
+}
+
+func (api *API) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, detail string, fields []problemField) {
+	var err error
+
+	if api.wantsProblemJSON(r) {
+		p := problem{
+			Type:     "/problems/" + strings.ReplaceAll(code, "_", "-"),
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   detail,
+			Instance: api.requestID(r),
+			Code:     code,
+			Errors:   fields,
+		}
+		err = api.writeProblem(w, status, p)
+	} else {
+		var message any = detail
+		if fields != nil {
+			errs := make(map[string]string, len(fields))
+			for _, f := range fields {
+				if _, exists := errs[f.key]; !exists {
+					errs[f.key] = f.Message
+				}
+			}
+			message = errs
+		}
+		err = api.writeJSON(w, status, envelope{"error": message}, nil)
+	}
+
 	if err != nil {
 		api.errorLog(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -19,26 +84,81 @@ func (api *API) errorResponse(w http.ResponseWriter, r *http.Request, status int
 }
 
 func (api *API) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	api.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	api.errorResponse(w, r, http.StatusBadRequest, "bad_request", err.Error(), nil)
 }
 
 func (api *API) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	api.errorResponse(w, r, http.StatusConflict, message)
+	api.errorResponse(w, r, http.StatusConflict, "edit_conflict", message, nil)
+}
+
+func (api *API) staleReconciliationResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("reconciliations can only be confirmed within %d hours of being made, please reconcile the roster again",
+		int(data.RosterReconciliationMaxAge.Hours()))
+	api.errorResponse(w, r, http.StatusConflict, "stale_reconciliation", message, nil)
 }
 
-func (api *API) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	api.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+func (api *API) jobNotRetryableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "only queued or dead jobs can be retried"
+	api.errorResponse(w, r, http.StatusConflict, "not_retryable", message, nil)
+}
+
+func (api *API) constraintViolationResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var duplicate data.ErrDuplicate
+	var foreignKey data.ErrForeignKey
+	var invalidValue data.ErrInvalidValue
+
+	v := validator.New()
+
+	switch {
+	case errors.As(err, &duplicate):
+		api.unknownConstraintLog(r, duplicate.Field, duplicate.Constraint)
+		v.AddErrorCode(duplicate.Field, validator.CodeDuplicate, "already exists")
+		api.errorResponse(w, r, http.StatusConflict, "duplicate", "a record with this value already exists", fieldProblems(v.Errors()))
+	case errors.As(err, &foreignKey):
+		api.unknownConstraintLog(r, foreignKey.Field, foreignKey.Constraint)
+		v.AddErrorCode(foreignKey.Field, validator.CodeNotFound, "does not exist")
+		api.errorResponse(w, r, http.StatusUnprocessableEntity, "invalid_reference", "a referenced record does not exist", fieldProblems(v.Errors()))
+	case errors.As(err, &invalidValue):
+		api.unknownConstraintLog(r, invalidValue.Field, invalidValue.Constraint)
+		v.AddErrorCode(invalidValue.Field, validator.CodeInvalid, "is not a valid value")
+		api.errorResponse(w, r, http.StatusUnprocessableEntity, "invalid_value", "a value was rejected by the database", fieldProblems(v.Errors()))
+	default:
+		api.serverErrorResponse(w, r, err)
+	}
+}
+
+// unknownConstraintLog records the database's name for a constraint that
+// has no API field, as the client is only told about a generic field.
+func (api *API) unknownConstraintLog(r *http.Request, field, constraint string) {
+	if field != data.UnknownConstraintField {
+		return
+	}
+
+	api.requestLogger(r).PrintWarn("constraint violation not mapped to a field", map[string]any{
+		"constraint":     constraint,
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+	})
+}
+
+func (api *API) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	api.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", "one or more fields failed validation", fieldProblems(v.Errors()))
 }
 
 func (api *API) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	api.errorResponse(w, r, http.StatusNotFound, message)
+	api.errorResponse(w, r, http.StatusNotFound, "not_found", message, nil)
+}
+
+func (api *API) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	api.errorResponse(w, r, http.StatusTooManyRequests, "rate_limited", message, nil)
 }
 
 func (api *API) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	api.errorLog(r, err)
 
 	message := "the server encounter a problem and could not process the request"
-	api.errorResponse(w, r, http.StatusInternalServerError, message)
+	api.errorResponse(w, r, http.StatusInternalServerError, "server_error", message, nil)
 }
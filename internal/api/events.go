@@ -0,0 +1,374 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	eventChannel         = "change_event"
+	eventFetchBatch      = 500
+	eventClientBuffer    = 256
+	eventHeartbeat       = 15 * time.Second
+	eventListenerPing    = time.Minute
+	eventRetryAfterDrop  = 3 * time.Second
+	eventHeldBackRetry   = time.Second
+	eventHeldBackRetries = 10
+)
+
+// eventFilter selects the events a stream client receives. Empty fields
+// match everything.
+type eventFilter struct {
+	entities   []string
+	projects   []string
+	workgroups []int64
+}
+
+func (f eventFilter) matches(e *data.ChangeEvent) bool {
+	if len(f.entities) > 0 {
+		entity, _, _ := strings.Cut(e.Type, ".")
+		if !validator.PermittedValue(entity, f.entities...) {
+			return false
+		}
+	}
+
+	if len(f.projects) > 0 && !validator.PermittedValue(e.OpportunityID, f.projects...) {
+		return false
+	}
+
+	if len(f.workgroups) > 0 {
+		for _, wg := range e.Workgroups {
+			if validator.PermittedValue(wg, f.workgroups...) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+type eventClient struct {
+	filter eventFilter
+	events chan *data.ChangeEvent
+}
+
+// eventHub fans change events out to the stream clients connected to this
+// replica. Every replica listens for the same notifications, so a client
+// sees every change whichever replica it is connected to.
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[*eventClient]struct{}
+	last    data.EventCursor
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[*eventClient]struct{})}
+}
+
+func (h *eventHub) subscribe(filter eventFilter) *eventClient {
+	c := &eventClient{filter: filter, events: make(chan *data.ChangeEvent, eventClientBuffer)}
+
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	return c
+}
+
+func (h *eventHub) unsubscribe(c *eventClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// publish sends e to every client whose filter matches it. A client that
+// has fallen a whole buffer behind is disconnected, and catches up from
+// the change log when it reconnects with Last-Event-ID.
+func (h *eventHub) publish(e *data.ChangeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		if !c.filter.matches(e) {
+			continue
+		}
+
+		select {
+		case c.events <- e:
+		default:
+			delete(h.clients, c)
+			close(c.events)
+		}
+	}
+}
+
+func (h *eventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+func (h *eventHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.clients)
+}
+
+// startEventStream listens for change notifications from Postgres and
+// publishes the new events to stream clients. Notifications only carry the
+// event ID, so after a notification, or after the listener reconnects and
+// may have missed some, the hub reads everything since the last event it
+// published from the change log. Events only become readable once every
+// older transaction has finished, so if the notified event is held back by
+// a transaction that is still open, the hub tries again every second for a
+// while. Events outside the stream are never published, so the retries are
+// bounded rather than kept up until the notified event appears.
+func (api *API) startEventStream() error {
+	last, err := api.models.Events.Latest()
+	if err != nil {
+		return err
+	}
+	api.events.last = last
+
+	listener := pq.NewListener(api.cfg.DB.DSN, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			api.logger.PrintWarn(err.Error(), map[string]any{"worker": "event-listener"})
+		}
+	})
+
+	err = listener.Listen(eventChannel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	api.metrics.registry.NewGaugeFunc("pso_event_stream_clients", "Clients connected to the event stream.", func() float64 {
+		return float64(api.events.count())
+	})
+
+	api.background("event-listener", func() {
+		defer listener.Close()
+		defer api.events.closeAll()
+
+		ticker := time.NewTicker(eventListenerPing)
+		defer ticker.Stop()
+
+		var notified, published int64
+		var retries int
+		var retry <-chan time.Time
+
+		for {
+			select {
+			case <-api.quit:
+				return
+			case n := <-listener.Notify:
+				if n != nil {
+					id, _ := strconv.ParseInt(n.Extra, 10, 64)
+					notified = max(notified, id)
+					retries = 0
+				}
+			case <-retry:
+			case <-ticker.C:
+				go listener.Ping()
+			}
+
+			last, err := api.publishEvents()
+			if err != nil {
+				api.logger.PrintError(err, map[string]any{"worker": "event-listener"})
+			}
+			published = max(published, last)
+
+			retry = nil
+			if published < notified && retries < eventHeldBackRetries {
+				retries++
+				retry = time.After(eventHeldBackRetry)
+			}
+		}
+	})
+
+	return nil
+}
+
+// publishEvents publishes the events after the last one published and
+// returns the highest event ID among them.
+func (api *API) publishEvents() (int64, error) {
+	var maxID int64
+
+	for {
+		events, err := api.models.Events.GetSince(api.events.last, eventFetchBatch)
+		if err != nil {
+			return maxID, err
+		}
+
+		for _, e := range events {
+			api.events.publish(e)
+			api.events.last = e.Cursor()
+			maxID = max(maxID, e.ID)
+		}
+
+		if len(events) < eventFetchBatch {
+			return maxID, nil
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e *data.ChangeEvent) error {
+	js, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, js)
+	return err
+}
+
+// handleEventStream streams change events as server-sent events. Clients
+// that reconnect with Last-Event-ID, or lastEventId for clients that
+// cannot set headers, are first sent the events they missed.
+func (api *API) handleEventStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter eventFilter
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		filter.entities = api.readCSV(qs, "types", nil)
+		filter.projects = api.readCSV(qs, "project", nil)
+		for _, s := range api.readCSV(qs, "workgroup", nil) {
+			id, err := strconv.ParseInt(s, 10, 64)
+			v.Check(err == nil, "workgroup", "must be a comma separated list of workgroup ids")
+			filter.workgroups = append(filter.workgroups, id)
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = qs.Get("lastEventId")
+		}
+
+		var afterID int64
+		if lastEventID != "" {
+			var err error
+			afterID, err = strconv.ParseInt(lastEventID, 10, 64)
+			v.Check(err == nil && afterID >= 0, "lastEventId", "must be an event id")
+		}
+
+		for _, entity := range filter.entities {
+			v.CheckCode(validator.PermittedValue(entity, data.EventStreamEntities...), "types", validator.CodeNotPermitted,
+				"must be a comma separated list of [project, request, comment, assignment]")
+		}
+
+		if !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		var after data.EventCursor
+		if lastEventID != "" {
+			var err error
+			after, err = api.models.Events.CursorFor(afterID)
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		rc := http.NewResponseController(w)
+
+		err := rc.SetWriteDeadline(time.Time{})
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		client := api.events.subscribe(filter)
+		defer api.events.unsubscribe(client)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", eventRetryAfterDrop.Milliseconds())
+
+		// Events published while the backlog is read are sent from the
+		// client's channel, so the backlog only needs to catch up to them.
+		if lastEventID != "" {
+			for {
+				events, err := api.models.Events.GetSince(after, eventFetchBatch)
+				if err != nil {
+					api.errorLog(r, err)
+					return
+				}
+
+				for _, e := range events {
+					if filter.matches(e) {
+						if err := writeEvent(w, e); err != nil {
+							return
+						}
+					}
+					after = e.Cursor()
+				}
+
+				if len(events) < eventFetchBatch {
+					break
+				}
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(eventHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case e, ok := <-client.events:
+				if !ok {
+					return
+				}
+				if !after.Before(e.Cursor()) {
+					continue
+				}
+				if err := writeEvent(w, e); err != nil {
+					return
+				}
+				after = e.Cursor()
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			case <-api.quit:
+				return
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+
+	"github.com/vmw-pso/back-end/migrations"
+)
+
+const referenceDataRefreshInterval = 5 * time.Minute
 
 func (api *API) handleHealthcheck() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -18,3 +25,86 @@ func (api *API) handleHealthcheck() http.HandlerFunc {
 		}
 	}
 }
+
+func (api *API) handleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := api.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ready := true
+		checks := envelope{}
+
+		start := time.Now()
+		err := api.models.System.Ping(2 * time.Second)
+		database := map[string]any{
+			"status":    "ok",
+			"latencyMs": time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			ready = false
+			database["status"] = "failed"
+			api.errorLog(r, err)
+		}
+		checks["database"] = database
+
+		expected := migrations.Latest()
+		current, dirty, err := api.models.System.MigrationVersion()
+		schema := map[string]any{
+			"status":   "ok",
+			"current":  current,
+			"expected": expected,
+			"dirty":    dirty,
+		}
+		switch {
+		case err != nil:
+			ready = false
+			schema["status"] = "failed"
+			api.errorLog(r, err)
+		case dirty || current != expected:
+			ready = false
+			schema["status"] = "mismatch"
+		}
+		checks["migrations"] = schema
+
+		loadedAt := api.models.ReferenceData.LoadedAt()
+		referenceData := map[string]any{
+			"status":   "ok",
+			"loadedAt": loadedAt,
+		}
+		switch {
+		case loadedAt.IsZero():
+			referenceData["status"] = "not loaded"
+		case time.Since(loadedAt) > 3*referenceDataRefreshInterval:
+			referenceData["status"] = "stale"
+		}
+		if !loadedAt.IsZero() {
+			referenceData["ageSeconds"] = int(time.Since(loadedAt).Seconds())
+		}
+		checks["referenceData"] = referenceData
+
+		checks["workers"] = api.workers.snapshot()
+
+		if api.shuttingDown.Load() {
+			ready = false
+			checks["shutdown"] = map[string]any{"status": "shutting down"}
+		}
+
+		status := http.StatusOK
+		env := envelope{"status": "ready", "checks": checks}
+		if !ready {
+			status = http.StatusServiceUnavailable
+			env["status"] = "not ready"
+		}
+
+		err = api.writeJSON(w, status, env, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/jsonlog"
 	"github.com/vmw-pso/back-end/internal/validator"
 )
 
@@ -95,6 +97,30 @@ func (api *API) writeJSON(w http.ResponseWriter, status int, data envelope, head
 	return nil
 }
 
+func (api *API) writeProblem(w http.ResponseWriter, status int, p problem) error {
+	js, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+func (api *API) requestID(r *http.Request) string {
+	return api.contextGetRequestInfo(r).id
+}
+
+// requestLogger returns a logger that tags every entry with the request ID.
+func (api *API) requestLogger(r *http.Request) *jsonlog.Logger {
+	return api.logger.With(map[string]any{"request_id": api.requestID(r)})
+}
+
 func (api *API) readString(qs url.Values, key string, defaultValue string) string {
 	str := qs.Get(key)
 	if str == "" {
@@ -138,3 +164,35 @@ func (api *API) readInt(qs url.Values, key string, defaultValue int, v *validato
 	}
 	return val
 }
+
+func (api *API) readCursor(qs url.Values, key string, v *validator.Validator) *data.Cursor {
+	str := qs.Get(key)
+	if str == "" {
+		return nil
+	}
+
+	cursor, err := data.DecodeCursor(str, []byte(api.cfg.Cursor.Secret))
+	if err != nil {
+		v.AddError(key, "must be a valid cursor")
+		return nil
+	}
+	return cursor
+}
+
+func (api *API) setPageLinks(r *http.Request, metadata *data.Metadata) {
+	link := func(key string, cursor *data.Cursor) string {
+		qs := r.URL.Query()
+		qs.Del("page")
+		qs.Del("after")
+		qs.Del("before")
+		qs.Set(key, cursor.Encode([]byte(api.cfg.Cursor.Secret)))
+		return r.URL.Path + "?" + qs.Encode()
+	}
+
+	if metadata.NextCursor != nil {
+		metadata.Next = link("after", metadata.NextCursor)
+	}
+	if metadata.PrevCursor != nil {
+		metadata.Prev = link("before", metadata.PrevCursor)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const importMaxBytes = 10 << 20
+
+// ImportResources runs a resource import outside the server, for the CLI.
+func (api *API) ImportResources(src io.Reader, dryRun bool) (*data.ResourceImportReport, error) {
+	db, err := openDB(api.cfg.DB.DSN, api.cfg.DB.MaxOpenConns, api.cfg.DB.MaxIdleConns, api.cfg.DB.MaxIdleTime)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	api.db = db
+	api.models = *data.NewModels(db)
+
+	return api.importResources(src, dryRun)
+}
+
+// importResources validates every row of an HR export and, unless dryRun is
+// set or any row is invalid, upserts them all. Managers may refer to other
+// people in the same file, who will not be on record until it is applied.
+func (api *API) importResources(src io.Reader, dryRun bool) (*data.ResourceImportReport, error) {
+	rows, err := data.ParseResourceCSV(src)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &data.ResourceImportReport{DryRun: dryRun, Rows: len(rows), Errors: []data.ResourceImportError{}}
+
+	byID := make(map[int64]*data.Resource, len(rows))
+	byName := make(map[string][]*data.Resource, len(rows))
+	for _, row := range rows {
+		byID[row.Resource.ID] = &row.Resource
+		name := strings.ToLower(row.Resource.Name)
+		byName[name] = append(byName[name], &row.Resource)
+	}
+
+	resources := make([]*data.Resource, 0, len(rows))
+	ids := make([]int64, 0, len(rows))
+
+	for _, row := range rows {
+		v := row.Validator
+		res := &row.Resource
+
+		err := api.models.References.Resolve(v, "jobTitle", data.RefJobTitle, &res.JobTitle)
+		if err != nil {
+			return nil, err
+		}
+
+		err = api.models.References.Resolve(v, "workgroup", data.RefWorkgroup, &res.Workgroup)
+		if err != nil {
+			return nil, err
+		}
+
+		manager := &res.Manager
+		switch {
+		case manager.ID != 0 && byID[manager.ID] != nil:
+			if manager.Name == "" {
+				manager.Name = byID[manager.ID].Name
+			}
+		case manager.ID == 0 && len(byName[strings.ToLower(manager.Name)]) == 1:
+			manager.ID = byName[strings.ToLower(manager.Name)][0].ID
+		default:
+			err = api.models.References.Resolve(v, "manager", data.RefResource, manager)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if data.ValidateResource(v, *res); !v.Valid() {
+			report.Errors = append(report.Errors, data.ResourceImportError{
+				Line:       row.Line,
+				EmployeeID: res.ID,
+				Errors:     v.Map(),
+			})
+			continue
+		}
+
+		resources = append(resources, res)
+		ids = append(ids, res.ID)
+	}
+
+	if len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	if dryRun {
+		existing, err := api.models.Resources.ExistingIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+		report.Updated = len(existing)
+		report.Created = len(resources) - report.Updated
+		return report, nil
+	}
+
+	report.Created, report.Updated, err = api.models.Resources.Import(resources)
+	if err != nil {
+		return nil, err
+	}
+	report.Applied = true
+
+	return report, nil
+}
+
+// handleImportResources takes an HR export as a text/csv request body. With
+// dryRun=true nothing is written and the report shows what would happen.
+func (api *API) handleImportResources() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		dryRun := api.readBool(r.URL.Query(), "dryRun", false, v)
+		if !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		report, err := api.importResources(http.MaxBytesReader(w, r.Body, importMaxBytes), dryRun)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesError):
+				api.badRequestResponse(w, r, errors.New("body must not be larger than 10MB"))
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
+			case errors.Is(err, data.ErrInvalidImport):
+				api.badRequestResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		status := http.StatusOK
+		if len(report.Errors) > 0 {
+			status = http.StatusUnprocessableEntity
+		}
+
+		err = api.writeJSON(w, status, envelope{"import": report}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
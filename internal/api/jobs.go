@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"os"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/cron"
+	"github.com/vmw-pso/back-end/internal/data"
+)
+
+const (
+	jobBackoffBase = 10 * time.Second
+	jobBackoffMax  = time.Hour
+
+	jobSchedulerInterval = 30 * time.Second
+	jobReaperInterval    = time.Minute
+)
+
+// jobHandler processes the payload of a single job. Returning an error
+// schedules a retry with backoff until the job runs out of attempts.
+type jobHandler func(ctx context.Context, payload json.RawMessage) error
+
+type scheduledJob struct {
+	kind     string
+	spec     string
+	schedule *cron.Schedule
+	last     time.Time
+}
+
+type jobRunner struct {
+	handlers  map[string]jobHandler
+	schedules []*scheduledJob
+	timeout   time.Duration
+
+	// ctx is passed to running jobs and is cancelled if they have not
+	// finished by the end of the drain period at shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newJobRunner() *jobRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobRunner{handlers: make(map[string]jobHandler), ctx: ctx, cancel: cancel}
+}
+
+// registerJob adds the handler for jobs of kind, decoding each payload into
+// a T. It must be called before the runner starts.
+func registerJob[T any](api *API, kind string, fn func(ctx context.Context, payload T) error) {
+	api.jobs.handlers[kind] = func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return fmt.Errorf("decoding %s payload: %w", kind, err)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// scheduleJob enqueues a job of kind, with an empty payload, each time the
+// cron spec fires. Every instance of the API runs the scheduler, so each
+// run is given a unique key to stop it being queued more than once.
+func (api *API) scheduleJob(spec, kind string) error {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	api.jobs.schedules = append(api.jobs.schedules, &scheduledJob{
+		kind:     kind,
+		spec:     spec,
+		schedule: schedule,
+		last:     time.Now(),
+	})
+	return nil
+}
+
+func newJob(kind string, payload any) (*data.Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Job{Kind: kind, Payload: js}, nil
+}
+
+// enqueueJob queues a job of kind to run as soon as a worker is free.
+func (api *API) enqueueJob(kind string, payload any) (*data.Job, error) {
+	job, err := newJob(kind, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.models.Jobs.Insert(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// startJobs starts the job workers, the cron scheduler and the reaper that
+// releases jobs abandoned by a crashed process.
+func (api *API) startJobs() error {
+	pollInterval, err := time.ParseDuration(api.cfg.Jobs.PollInterval)
+	if err != nil {
+		return err
+	}
+
+	api.jobs.timeout, err = time.ParseDuration(api.cfg.Jobs.Timeout)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+
+	for i := 0; i < api.cfg.Jobs.Workers; i++ {
+		worker := fmt.Sprintf("%s/%d/%d", host, os.Getpid(), i)
+
+		api.background("job-worker", func() {
+			for {
+				select {
+				case <-api.quit:
+					return
+				default:
+				}
+
+				ran, err := api.runNextJob(worker)
+				if err != nil {
+					api.logger.PrintError(err, map[string]any{"worker": worker})
+				}
+				if ran {
+					continue
+				}
+
+				select {
+				case <-api.quit:
+					return
+				case <-time.After(pollInterval):
+				}
+			}
+		})
+	}
+
+	api.runWorker("job-scheduler", jobSchedulerInterval, api.enqueueScheduledJobs)
+	api.runWorker("job-reaper", jobReaperInterval, func() error {
+		n, err := api.models.Jobs.RequeueStale(api.jobs.timeout + time.Minute)
+		if n > 0 {
+			api.logger.PrintWarn("released stale jobs", map[string]any{"count": n})
+		}
+		return err
+	})
+
+	return nil
+}
+
+// drainJobs gives running jobs until timeout to finish before their
+// context is cancelled. Workers stop claiming new jobs once api.quit closes.
+func (api *API) drainJobs(timeout time.Duration) {
+	time.AfterFunc(timeout, api.jobs.cancel)
+}
+
+// runNextJob claims and runs one job, reporting whether there was one.
+func (api *API) runNextJob(worker string) (bool, error) {
+	job, err := api.models.Jobs.Claim(worker)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	logger := api.logger.With(map[string]any{"job_id": job.ID, "kind": job.Kind, "attempt": job.Attempts})
+
+	start := time.Now()
+	err = api.runJob(job)
+	api.metrics.jobDuration.Observe(time.Since(start).Seconds(), job.Kind)
+
+	switch {
+	case err == nil:
+		err = api.models.Jobs.Complete(job.ID, worker)
+		if errors.Is(err, data.ErrEditConflict) {
+			logger.PrintWarn("job was released before it succeeded", nil)
+			return true, nil
+		}
+		api.metrics.jobs.Inc(job.Kind, "succeeded")
+		return true, err
+	case api.jobs.ctx.Err() != nil:
+		// The drain at shutdown cancelled the job, which says nothing about
+		// whether it would have succeeded, so the attempt is not counted.
+		api.metrics.jobs.Inc(job.Kind, "released")
+		logger.PrintWarn(err.Error(), map[string]any{"outcome": "released"})
+		err = api.models.Jobs.Release(job.ID, worker)
+		if errors.Is(err, data.ErrEditConflict) {
+			return true, nil
+		}
+		return true, err
+	}
+
+	retryAt := time.Now().Add(jobBackoff(job.Attempts))
+
+	dead, ferr := api.models.Jobs.Fail(job.ID, worker, err, retryAt)
+	if errors.Is(ferr, data.ErrEditConflict) {
+		logger.PrintWarn("job was released before it failed", map[string]any{"error": err.Error()})
+		return true, nil
+	}
+	if ferr != nil {
+		return true, ferr
+	}
+
+	if dead {
+		api.metrics.jobs.Inc(job.Kind, "dead")
+		logger.PrintError(err, map[string]any{"outcome": "dead"})
+		return true, nil
+	}
+
+	api.metrics.jobs.Inc(job.Kind, "retry")
+	logger.PrintWarn(err.Error(), map[string]any{"outcome": "retry", "retry_at": retryAt})
+	return true, nil
+}
+
+func (api *API) runJob(job *data.Job) (err error) {
+	handler, ok := api.jobs.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(api.jobs.ctx, api.jobs.timeout)
+	defer cancel()
+
+	return handler(ctx, job.Payload)
+}
+
+// jobBackoff returns the delay before retrying a job that has failed
+// attempts times: exponential with 20% jitter, capped at jobBackoffMax.
+func jobBackoff(attempts int) time.Duration {
+	delay := float64(jobBackoffBase) * math.Pow(2, float64(attempts-1))
+	delay = math.Min(delay, float64(jobBackoffMax))
+	delay *= 0.8 + 0.4*mathrand.Float64()
+	return time.Duration(delay)
+}
+
+func (api *API) enqueueScheduledJobs() error {
+	now := time.Now()
+
+	for _, s := range api.jobs.schedules {
+		for next := s.schedule.Next(s.last); !next.IsZero() && !next.After(now); next = s.schedule.Next(next) {
+			job := &data.Job{
+				Kind:      s.kind,
+				RunAt:     next,
+				UniqueKey: fmt.Sprintf("cron:%s:%s", s.kind, next.UTC().Format(time.RFC3339)),
+			}
+
+			err := api.models.Jobs.Insert(job)
+			if err != nil {
+				return err
+			}
+			s.last = next
+		}
+	}
+
+	return nil
+}
+
+// registerJobs declares the jobs this API runs. Jobs for other subsystems
+// are registered alongside them.
+func (api *API) registerJobs() error {
+	registerJob(api, "jobs.cleanup", func(ctx context.Context, _ struct{}) error {
+		n, err := api.models.Jobs.DeleteSucceeded(time.Now().AddDate(0, 0, -api.cfg.Jobs.RetentionDays))
+		if err == nil && n > 0 {
+			api.logger.PrintInfo("deleted old jobs", map[string]any{"count": n})
+		}
+		return err
+	})
+
+	err := api.scheduleJob("@daily", "jobs.cleanup")
+	if err != nil {
+		return err
+	}
+
+	registerJob(api, "notifications.cleanup", func(ctx context.Context, _ struct{}) error {
+		notifications, events, err := api.models.Notifications.DeleteBefore(time.Now().AddDate(0, 0, -api.cfg.Notifications.RetentionDays))
+		if err == nil && notifications+events > 0 {
+			api.logger.PrintInfo("deleted old notifications", map[string]any{"notifications": notifications, "events": events})
+		}
+		return err
+	})
+
+	err = api.scheduleJob("@daily", "notifications.cleanup")
+	if err != nil {
+		return err
+	}
+
+	registerJob(api, "webhooks.cleanup", func(ctx context.Context, _ struct{}) error {
+		deliveries, events, err := api.models.Webhooks.DeleteBefore(time.Now().AddDate(0, 0, -api.cfg.Webhooks.RetentionDays))
+		if err == nil && deliveries+events > 0 {
+			api.logger.PrintInfo("deleted old webhook deliveries", map[string]any{"deliveries": deliveries, "events": events})
+		}
+		return err
+	})
+
+	err = api.scheduleJob("@daily", "webhooks.cleanup")
+	if err != nil {
+		return err
+	}
+
+	err = api.registerNotificationJobs()
+	if err != nil {
+		return err
+	}
+
+	err = api.registerWebhookJobs()
+	if err != nil {
+		return err
+	}
+
+	return api.registerChangepointJobs()
+}
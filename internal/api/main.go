@@ -3,11 +3,14 @@ package api
 import (
 	"context"
 	"database/sql"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmw-pso/back-end/internal/data"
 	"github.com/vmw-pso/back-end/internal/jsonlog"
+	"github.com/vmw-pso/back-end/internal/mailer"
 
 	_ "github.com/lib/pq"
 )
@@ -17,9 +20,13 @@ const (
 )
 
 type Config struct {
-	Port int64
-	Env  string
-	DB   struct {
+	Port          int64
+	Env           string
+	ShutdownDelay string
+	Admin         struct {
+		Port int64
+	}
+	DB struct {
 		DSN          string
 		MaxOpenConns int
 		MaxIdleConns int
@@ -28,22 +35,97 @@ type Config struct {
 	CORS struct {
 		TrustedOrigins []string
 	}
+	Cursor struct {
+		Secret string
+	}
+	Log struct {
+		Level          string
+		SampleRate     float64
+		RedactFields   []string
+		RedactPatterns []string
+	}
+	Limiter struct {
+		Enabled        bool
+		RPS            float64
+		Burst          int
+		TrustedProxies []string
+		Routes         map[string]RouteLimit
+	}
+	SMTP struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+	}
+	Jobs struct {
+		Workers       int
+		PollInterval  string
+		Timeout       string
+		DrainTimeout  string
+		RetentionDays int
+	}
+	Notifications struct {
+		RetentionDays int
+	}
+	Webhooks struct {
+		AllowPrivate  bool
+		RetentionDays int
+	}
+	Changepoint struct {
+		Source   string
+		Schedule string
+	}
+	Features map[string]bool
 }
 
 type API struct {
-	cfg    *Config
-	logger *jsonlog.Logger
-	db     *sql.DB
-	models data.Models
-	wg     sync.WaitGroup
+	cfg     *Config
+	live    atomic.Pointer[liveConfig]
+	reload  func() (*Config, error)
+	logger  *jsonlog.Logger
+	db      *sql.DB
+	models  data.Models
+	metrics *apiMetrics
+	workers workerRegistry
+	jobs    *jobRunner
+	events  *eventHub
+	hooks   *http.Client
+	mailer  mailer.Mailer
+	wg      sync.WaitGroup
+
+	limiter *rateLimiter
+
+	quit         chan struct{}
+	shuttingDown atomic.Bool
 }
 
 func New(cfg *Config, logger *jsonlog.Logger) (*API, error) {
 	api := &API{
-		cfg:    cfg,
-		logger: logger,
+		cfg:     cfg,
+		logger:  logger,
+		metrics: newAPIMetrics(),
+		quit:    make(chan struct{}),
+		limiter: newRateLimiter(),
+		jobs:    newJobRunner(),
+		events:  newEventHub(),
+		hooks:   newWebhookClient(cfg.Webhooks.AllowPrivate),
 	}
 
+	m, err := mailer.New(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Sender)
+	if err != nil {
+		return nil, err
+	}
+	api.mailer = m
+
+	live, err := newLiveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	api.live.Store(live)
+	logger.SetLevel(live.logLevel)
+	logger.SetRedactor(live.redactor)
+
 	return api, nil
 }
 
@@ -59,6 +141,36 @@ func (api *API) Run() error {
 	api.db = db
 	api.models = *data.NewModels(db)
 
+	api.registerDBMetrics()
+
+	err = api.models.ReferenceData.Refresh()
+	if err != nil {
+		api.logger.PrintError(err, map[string]any{"worker": "reference-data"})
+	}
+
+	api.runWorker("reference-data", referenceDataRefreshInterval, api.models.ReferenceData.Refresh)
+	api.runWorker("rate-limiter-cleanup", time.Minute, func() error {
+		return api.limiter.cleanup(3 * time.Minute)
+	})
+
+	api.runWorker("notification-dispatcher", notificationDispatchInterval, api.dispatchNotifications)
+	api.runWorker("webhook-dispatcher", webhookDispatchInterval, api.dispatchWebhooks)
+
+	err = api.startEventStream()
+	if err != nil {
+		return err
+	}
+
+	err = api.registerJobs()
+	if err != nil {
+		return err
+	}
+
+	err = api.startJobs()
+	if err != nil {
+		return err
+	}
+
 	return api.serve()
 }
 
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/metrics"
+)
+
+type apiMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	panics          *metrics.CounterVec
+	tasks           *metrics.CounterVec
+	jobs            *metrics.CounterVec
+	jobDuration     *metrics.HistogramVec
+}
+
+func newAPIMetrics() *apiMetrics {
+	reg := metrics.NewRegistry()
+
+	return &apiMetrics{
+		registry:        reg,
+		requests:        reg.NewCounterVec("pso_http_requests_total", "HTTP requests by method, route and status.", "method", "route", "status"),
+		requestDuration: reg.NewHistogramVec("pso_http_request_duration_seconds", "HTTP request latency by method and route.", metrics.DefaultBuckets, "method", "route"),
+		panics:          reg.NewCounterVec("pso_http_panics_total", "Panics recovered while serving HTTP requests."),
+		tasks:           reg.NewCounterVec("pso_background_tasks_total", "Background tasks by name and outcome.", "task", "outcome"),
+		jobs:            reg.NewCounterVec("pso_jobs_total", "Job attempts by kind and outcome.", "kind", "outcome"),
+		jobDuration:     reg.NewHistogramVec("pso_job_duration_seconds", "Job run time by kind.", []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}, "kind"),
+	}
+}
+
+// registerDBMetrics adds connection pool and business gauges once the
+// database is available.
+func (api *API) registerDBMetrics() {
+	reg := api.metrics.registry
+
+	reg.NewGaugeFunc("pso_db_open_connections", "Established database connections, in use and idle.", func() float64 {
+		return float64(api.db.Stats().OpenConnections)
+	})
+	reg.NewGaugeFunc("pso_db_in_use_connections", "Database connections currently in use.", func() float64 {
+		return float64(api.db.Stats().InUse)
+	})
+	reg.NewGaugeFunc("pso_db_idle_connections", "Idle database connections.", func() float64 {
+		return float64(api.db.Stats().Idle)
+	})
+	reg.NewGaugeFunc("pso_db_max_open_connections", "Maximum number of open database connections.", func() float64 {
+		return float64(api.db.Stats().MaxOpenConnections)
+	})
+	reg.NewCounterFunc("pso_db_wait_count_total", "Connections waited for.", func() float64 {
+		return float64(api.db.Stats().WaitCount)
+	})
+	reg.NewCounterFunc("pso_db_wait_duration_seconds_total", "Time spent waiting for connections.", func() float64 {
+		return api.db.Stats().WaitDuration.Seconds()
+	})
+	reg.NewGaugeFunc("pso_open_resource_requests", "Resource requests with status Open.", func() float64 {
+		count, err := api.models.ResourceRequests.CountOpen()
+		if err != nil {
+			api.logger.PrintError(err, map[string]any{"metric": "pso_open_resource_requests"})
+			return math.NaN()
+		}
+		return float64(count)
+	})
+	for _, status := range []string{data.JobQueued, data.JobDead} {
+		status := status
+		reg.NewGaugeFunc("pso_jobs_"+status, "Jobs with status "+status+".", func() float64 {
+			counts, err := api.models.Jobs.CountByStatus()
+			if err != nil {
+				api.logger.PrintError(err, map[string]any{"metric": "pso_jobs_" + status})
+				return math.NaN()
+			}
+			return float64(counts[status])
+		})
+	}
+	reg.NewGaugeFunc("pso_bench_size", "Active resources with no current assignment.", func() float64 {
+		count, err := api.models.Resources.CountBench()
+		if err != nil {
+			api.logger.PrintError(err, map[string]any{"metric": "pso_bench_size"})
+			return math.NaN()
+		}
+		return float64(count)
+	})
+}
+
+func (api *API) observeRequest(method, route string, status int, seconds float64) {
+	if route == "" {
+		route = "unmatched"
+	}
+	api.metrics.requests.Inc(method, route, strconv.Itoa(status))
+	api.metrics.requestDuration.Observe(seconds, method, route)
+}
+
+// background runs fn in a goroutine tracked by the API's wait group so that
+// serve() can wait for it during shutdown.
+func (api *API) background(task string, fn func()) {
+	api.wg.Add(1)
+
+	go func() {
+		defer api.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				api.metrics.tasks.Inc(task, "panic")
+				api.logger.PrintError(fmt.Errorf("%s", err), map[string]any{"task": task})
+			}
+		}()
+
+		fn()
+		api.metrics.tasks.Inc(task, "success")
+	}()
+}
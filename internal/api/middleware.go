@@ -1,14 +1,22 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	mathrand "math/rand"
 	"net/http"
+	"regexp"
+	"time"
 )
 
+var rxRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
 func (api *API) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				api.metrics.panics.Inc()
 				w.Header().Set("Connection", "close")
 				api.serverErrorResponse(w, r, fmt.Errorf("%s", err))
 			}
@@ -24,10 +32,11 @@ func (api *API) enableCORS(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Access-Control-Request-Method")
 
 		origin := r.Header.Get("Origin")
+		trustedOrigins := api.live.Load().CORS.TrustedOrigins
 
 		if origin != "" {
-			for i := range api.cfg.CORS.TrustedOrigins {
-				if origin == api.cfg.CORS.TrustedOrigins[i] {
+			for i := range trustedOrigins {
+				if origin == trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Allow-Method") != "" {
@@ -44,3 +53,92 @@ func (api *API) enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requireFeature serves the route only while the named feature flag is on,
+// checking on every request so that a reload takes effect straight away.
+func (api *API) requireFeature(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.featureEnabled(name) {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (api *API) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !rxRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		r = api.contextSetRequestInfo(r, &requestInfo{id: id})
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder captures the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+func (api *API) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		latency := time.Since(start)
+		info := api.contextGetRequestInfo(r)
+
+		api.observeRequest(r.Method, info.route, rec.status, latency.Seconds())
+
+		if rec.status < http.StatusBadRequest && mathrand.Float64() >= api.live.Load().Log.SampleRate {
+			return
+		}
+
+		api.requestLogger(r).PrintInfo("request completed", map[string]any{
+			"method":     r.Method,
+			"route":      info.route,
+			"status":     rec.status,
+			"bytes":      rec.bytes,
+			"latency_ms": float64(latency.Microseconds()) / 1000,
+			"caller":     api.clientIP(r),
+			"user_agent": r.UserAgent(),
+		})
+	})
+}
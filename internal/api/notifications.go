@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	notificationDispatchInterval  = 10 * time.Second
+	notificationDispatchBatch     = 100
+	certificationExpiryNoticeDays = 30
+)
+
+type sendNotificationPayload struct {
+	ID int64 `json:"id"`
+}
+
+// registerNotificationJobs sets up email notifications. Database triggers
+// record staffing events; the dispatcher turns them into outbox entries for
+// each interested user, and a job sends each entry through the SMTP relay.
+func (api *API) registerNotificationJobs() error {
+	registerJob(api, "notification.send", func(ctx context.Context, p sendNotificationPayload) error {
+		n, err := api.models.Notifications.Get(p.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if n.Status == "sent" {
+			return nil
+		}
+
+		err = api.mailer.Send(n.Recipient, n.Template, n.Data)
+		if rerr := api.models.Notifications.RecordAttempt(n.ID, err); rerr != nil && err == nil {
+			return rerr
+		}
+		return err
+	})
+
+	registerJob(api, "notifications.certification-expiry", func(ctx context.Context, _ struct{}) error {
+		_, err := api.models.Notifications.QueueCertificationExpiry(certificationExpiryNoticeDays)
+		return err
+	})
+
+	return api.scheduleJob("0 6 * * *", "notifications.certification-expiry")
+}
+
+func (api *API) dispatchNotifications() error {
+	for {
+		n, err := api.models.Notifications.Dispatch(notificationDispatchBatch, "notification.send")
+		if err != nil || n < notificationDispatchBatch {
+			return err
+		}
+	}
+}
+
+func (api *API) handleShowNotificationPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		_, err = api.models.Resources.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		prefs, err := api.models.Notifications.GetPreferences(id)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"preferences": prefs}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleUpdateNotificationPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		_, err = api.models.Resources.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		var input struct {
+			Preferences map[string]bool `json:"preferences"`
+		}
+
+		err = api.readJSON(w, r, &input)
+		if err != nil {
+			api.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateNotificationPreferences(v, input.Preferences); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = api.models.Notifications.UpdatePreferences(id, input.Preferences)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		prefs, err := api.models.Notifications.GetPreferences(id)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"preferences": prefs}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
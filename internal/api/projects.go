@@ -11,14 +11,14 @@ import (
 func (api *API) handleCreateProject() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var input struct {
-			OpportunityID  string `json:"opportunityId"`
-			ChangepointID  string `json:"changepointId"`
-			RevenueType    string `json:"revenueType"`
-			Name           string `json:"name"`
-			Customer       string `json:"customer"`
-			EndCustomer    string `json:"endCustomer"`
-			ProjectManager string `json:"projectManager"`
-			Status         string `json:"status"`
+			OpportunityID  string   `json:"opportunityId"`
+			ChangepointID  string   `json:"changepointId"`
+			RevenueType    string   `json:"revenueType"`
+			Name           string   `json:"name"`
+			Customer       string   `json:"customer"`
+			EndCustomer    string   `json:"endCustomer"`
+			ProjectManager data.Ref `json:"projectManager"`
+			Status         string   `json:"status"`
 		}
 
 		err := api.readJSON(w, r, &input)
@@ -40,14 +40,25 @@ func (api *API) handleCreateProject() http.HandlerFunc {
 
 		v := validator.New()
 
+		err = api.models.References.ResolveProject(v, &project)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
 		if data.ValidateProject(v, project); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
 			return
 		}
 
 		err = api.models.Projects.Insert(&project)
 		if err != nil {
-			api.serverErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 
@@ -74,13 +85,13 @@ func (api *API) handleUpdateProject() http.HandlerFunc {
 		}
 
 		var input struct {
-			ChangepointID  *string `json:"changepointId"`
-			RevenueType    *string `json:"revenueType"`
-			Name           *string `json:"name"`
-			Customer       *string `json:"customer"`
-			EndCustomer    *string `json:"endCustomer"`
-			ProjectManager *string `json:"projectManager"`
-			Status         *string `json:"status"`
+			ChangepointID  *string   `json:"changepointId"`
+			RevenueType    *string   `json:"revenueType"`
+			Name           *string   `json:"name"`
+			Customer       *string   `json:"customer"`
+			EndCustomer    *string   `json:"endCustomer"`
+			ProjectManager *data.Ref `json:"projectManager"`
+			Status         *string   `json:"status"`
 		}
 
 		err = api.readJSON(w, r, &input)
@@ -119,8 +130,14 @@ func (api *API) handleUpdateProject() http.HandlerFunc {
 
 		v := validator.New()
 
+		err = api.models.References.ResolveProject(v, project)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
 		if data.ValidateProject(v, *project); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
 			return
 		}
 
@@ -129,6 +146,8 @@ func (api *API) handleUpdateProject() http.HandlerFunc {
 			switch {
 			case errors.Is(err, data.ErrEditConflict):
 				api.editConflictResponse(w, r)
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
 			default:
 				api.serverErrorResponse(w, r, err)
 			}
@@ -146,57 +165,29 @@ func (api *API) handleShowProject() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := api.readIDStringParam(r)
 
-		project, err := api.models.Projects.Get(id)
-		if err != nil {
-			switch {
-			case errors.Is(err, data.ErrNotFound):
-				api.notFoundResponse(w, r)
-			default:
-				api.serverErrorResponse(w, r, err)
-			}
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		include := api.readCSV(qs, "include", []string{"requests", "comments", "assignments"})
+
+		if data.ValidateProjectIncludes(v, include); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
 			return
 		}
 
-		resourceRequests, err := api.models.ResourceRequests.GetForOpportunity(id)
+		project, err := api.models.Projects.GetAggregate(id, data.NewProjectIncludes(include))
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrNotFound):
-				resourceRequests = []*data.ResourceRequest{}
+				api.notFoundResponse(w, r)
 			default:
 				api.serverErrorResponse(w, r, err)
-				return
-			}
-		}
-
-		for _, req := range resourceRequests {
-			comments, err := api.models.ResourceRequestComments.GetForRequest(req.ID)
-			if err != nil {
-				switch {
-				case errors.Is(err, data.ErrNotFound):
-					comments = []*data.ResourceRequestComment{}
-				default:
-					api.serverErrorResponse(w, r, err)
-					return
-				}
-			}
-			req.Comments = comments
-
-			assignments, err := api.models.ResourceAssignments.GetForRequest(req.ID)
-			if err != nil {
-				switch {
-				case errors.Is(err, data.ErrNotFound):
-					assignments = []*data.ResourceAssignment{}
-				default:
-					api.serverErrorResponse(w, r, err)
-					return
-				}
 			}
-			req.Assignments = assignments
+			return
 		}
 
-		project.ResourceRequests = resourceRequests
-
-		err = api.writeJSON(w, http.StatusCreated, envelope{"project": project}, nil)
+		err = api.writeJSON(w, http.StatusOK, envelope{"project": project}, nil)
 		if err != nil {
 			api.serverErrorResponse(w, r, err)
 		}
@@ -229,9 +220,24 @@ func (api *API) handleListProjects() http.HandlerFunc {
 		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
 		input.Filters.Sort = api.readString(qs, "sort", "opportunity_id")
 		input.Filters.SortSafelist = []string{"opportunity_id", "customer", "end_customer", "project_manager", "-opportunity_id", "-customer", "-end_customer", "-project_manager"}
+		input.Filters.After = api.readCursor(qs, "after", v)
+		input.Filters.Before = api.readCursor(qs, "before", v)
+		input.Filters.SkipCount = !api.readBool(qs, "count", true, v)
+		input.Filters.Expr = data.ParseFilter(v, api.readString(qs, "filter", ""), data.ProjectFilterFields)
 
 		if data.ValidateFilters(v, input.Filters); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		if api.wantsCSV(r) {
+			err := writeCSVList(api, w, r, "projects", input.Filters, func(f data.Filters) ([]*data.Project, data.Metadata, error) {
+				return api.models.Projects.GetAll(input.Customer, input.EndCustomer,
+					input.ProjectManager, input.Status, input.RevenueType, input.ChangepointID, f)
+			})
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 
@@ -242,6 +248,8 @@ func (api *API) handleListProjects() http.HandlerFunc {
 			return
 		}
 
+		api.setPageLinks(r, &metadata)
+
 		err = api.writeJSON(w, http.StatusOK, envelope{"projects": projects, "metadata": metadata}, nil)
 		if err != nil {
 			api.serverErrorResponse(w, r, err)
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RouteLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// ParseRouteLimit parses a per-route override of the form "/v1/search=1:5".
+func ParseRouteLimit(s string) (string, RouteLimit, error) {
+	route, limit, ok := strings.Cut(s, "=")
+	rps, burst, ok2 := strings.Cut(limit, ":")
+	if !ok || !ok2 || route == "" {
+		return "", RouteLimit{}, fmt.Errorf("invalid route limit %q, expected route=rps:burst", s)
+	}
+
+	var rl RouteLimit
+	var err error
+
+	rl.RPS, err = strconv.ParseFloat(rps, 64)
+	if err != nil || rl.RPS <= 0 {
+		return "", RouteLimit{}, fmt.Errorf("invalid rps in route limit %q", s)
+	}
+
+	rl.Burst, err = strconv.Atoi(burst)
+	if err != nil || rl.Burst < 1 {
+		return "", RouteLimit{}, fmt.Errorf("invalid burst in route limit %q", s)
+	}
+
+	return route, rl, nil
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens.
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the bucket for key, returning whether one was
+// available, the tokens left and how long until the bucket is full again.
+func (rl *rateLimiter) allow(key string, limit RouteLimit) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	burst := float64(limit.Burst)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.RPS)
+	b.last = now
+	b.lastSeen = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	reset := time.Duration((burst - b.tokens) / limit.RPS * float64(time.Second))
+
+	return allowed, int(b.tokens), reset
+}
+
+func (rl *rateLimiter) cleanup(idle time.Duration) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, b := range rl.buckets {
+		if time.Since(b.lastSeen) > idle {
+			delete(rl.buckets, key)
+		}
+	}
+	return nil
+}
+
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+func trustedProxy(proxies []*net.IPNet, ip net.IP) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the caller. X-Forwarded-For is only
+// honoured when the request arrives from a trusted proxy, and is read from
+// the right so that clients cannot spoof their address.
+func (api *API) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	proxies := api.live.Load().trustedProxies
+
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxy(proxies, ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !trustedProxy(proxies, hop) {
+			return hop.String()
+		}
+	}
+
+	return host
+}
+
+func (api *API) rateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := api.live.Load()
+		if !cfg.Limiter.Enabled {
+			next(w, r)
+			return
+		}
+
+		bucket := "global"
+		limit := RouteLimit{RPS: cfg.Limiter.RPS, Burst: cfg.Limiter.Burst}
+		if override, ok := cfg.Limiter.Routes[route]; ok {
+			bucket = route
+			limit = override
+		}
+
+		allowed, remaining, reset := api.limiter.allow(bucket+"|ip:"+api.clientIP(r), limit)
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+		if !allowed {
+			retryAfter := int(math.Ceil(1 / limit.RPS))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			api.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
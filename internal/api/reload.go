@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/vmw-pso/back-end/internal/jsonlog"
+)
+
+// liveConfig is the configuration currently in effect. Settings that can be
+// changed without a restart are read through it, and the whole value is
+// swapped atomically when the configuration is reloaded.
+type liveConfig struct {
+	*Config
+	logLevel       jsonlog.Level
+	redactor       *jsonlog.Redactor
+	trustedProxies []*net.IPNet
+}
+
+func newLiveConfig(cfg *Config) (*liveConfig, error) {
+	level := jsonlog.LevelInfo
+	if cfg.Log.Level != "" {
+		var err error
+		level, err = jsonlog.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	redactor, err := jsonlog.NewRedactor(jsonlog.DefaultRedactionRules, jsonlog.RedactionRules{
+		Fields:   cfg.Log.RedactFields,
+		Patterns: cfg.Log.RedactPatterns,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.Limiter.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &liveConfig{Config: cfg, logLevel: level, redactor: redactor, trustedProxies: trustedProxies}, nil
+}
+
+// SetReloader sets the function used to re-read the configuration when the
+// process receives SIGHUP.
+func (api *API) SetReloader(fn func() (*Config, error)) {
+	api.reload = fn
+}
+
+// Features are the feature flags the server knows and whether each is on
+// when it is not configured. Routes served under a feature are not found
+// while it is switched off.
+var Features = map[string]bool{
+	"event-stream": true,
+	"search":       true,
+}
+
+// featureEnabled reports whether the named feature flag is switched on.
+func (api *API) featureEnabled(name string) bool {
+	if enabled, ok := api.live.Load().Features[name]; ok {
+		return enabled
+	}
+	return Features[name]
+}
+
+// reloadConfig re-reads the configuration and applies changes to the
+// reloadable settings. The reload is rejected as a whole if it would change
+// a setting that needs a restart.
+func (api *API) reloadConfig() error {
+	if api.reload == nil {
+		return fmt.Errorf("configuration reload is not supported")
+	}
+
+	cfg, err := api.reload()
+	if err != nil {
+		return err
+	}
+
+	if changed := staticChanges(api.cfg, cfg); len(changed) > 0 {
+		return fmt.Errorf("cannot reload changes to %s without a restart", strings.Join(changed, ", "))
+	}
+
+	live, err := newLiveConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	changes := reloadableChanges(api.live.Load().Config, cfg)
+
+	api.live.Store(live)
+	api.logger.SetLevel(live.logLevel)
+	api.logger.SetRedactor(live.redactor)
+
+	if len(changes) == 0 {
+		api.logger.PrintInfo("configuration reloaded with no changes", nil)
+		return nil
+	}
+
+	api.logger.PrintInfo("configuration reloaded", changes)
+	return nil
+}
+
+func staticChanges(old, new *Config) []string {
+	var changed []string
+
+	if old.Port != new.Port {
+		changed = append(changed, "port")
+	}
+	if old.Env != new.Env {
+		changed = append(changed, "env")
+	}
+	if old.ShutdownDelay != new.ShutdownDelay {
+		changed = append(changed, "shutdown-delay")
+	}
+	if old.Admin != new.Admin {
+		changed = append(changed, "admin-port")
+	}
+	if old.DB != new.DB {
+		changed = append(changed, "db")
+	}
+	if old.SMTP != new.SMTP {
+		changed = append(changed, "smtp")
+	}
+	if old.Jobs != new.Jobs {
+		changed = append(changed, "jobs")
+	}
+	if old.Notifications != new.Notifications {
+		changed = append(changed, "notifications")
+	}
+	if old.Webhooks != new.Webhooks {
+		changed = append(changed, "webhooks")
+	}
+	if old.Cursor != new.Cursor {
+		changed = append(changed, "cursor-secret")
+	}
+
+	return changed
+}
+
+// reloadableChanges describes each changed reloadable setting as "old -> new".
+func reloadableChanges(old, new *Config) map[string]any {
+	changes := make(map[string]any)
+
+	diff := func(name string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changes[name] = fmt.Sprintf("%v -> %v", a, b)
+		}
+	}
+
+	diff("cors-trusted-origins", old.CORS.TrustedOrigins, new.CORS.TrustedOrigins)
+	diff("log-level", old.Log.Level, new.Log.Level)
+	diff("log-sample-rate", old.Log.SampleRate, new.Log.SampleRate)
+	diff("log-redact-fields", old.Log.RedactFields, new.Log.RedactFields)
+	diff("log-redact-patterns", old.Log.RedactPatterns, new.Log.RedactPatterns)
+	diff("limiter-enabled", old.Limiter.Enabled, new.Limiter.Enabled)
+	diff("limiter-rps", old.Limiter.RPS, new.Limiter.RPS)
+	diff("limiter-burst", old.Limiter.Burst, new.Limiter.Burst)
+	diff("limiter-trusted-proxies", old.Limiter.TrustedProxies, new.Limiter.TrustedProxies)
+	diff("limiter-routes", old.Limiter.Routes, new.Limiter.Routes)
+	diff("features", old.Features, new.Features)
+
+	return changes
+}
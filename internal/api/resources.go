@@ -14,9 +14,9 @@ func (api *API) handleCreateResource() http.HandlerFunc {
 			ID             int64    `json:"id"`
 			Name           string   `json:"name"`
 			Email          string   `json:"email"`
-			JobTitle       string   `json:"jobTitle"`
-			Manager        string   `json:"manager"`
-			Workgroup      string   `json:"workgroup"`
+			JobTitle       data.Ref `json:"jobTitle"`
+			Manager        data.Ref `json:"manager"`
+			Workgroup      data.Ref `json:"workgroup"`
 			Clearance      string   `json:"clearance"`
 			Specialties    []string `json:"specialties"`
 			Certifications []string `json:"certifications"`
@@ -43,14 +43,25 @@ func (api *API) handleCreateResource() http.HandlerFunc {
 
 		v := validator.New()
 
+		err = api.models.References.ResolveResource(v, &resource)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
 		if data.ValidateResource(v, resource); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
 			return
 		}
 
 		err = api.models.Resources.Insert(&resource)
 		if err != nil {
-			api.serverErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 
@@ -81,14 +92,14 @@ func (api *API) handleUpdateResource() http.HandlerFunc {
 		}
 
 		var input struct {
-			Name           *string  `json:"name"`
-			Email          *string  `json:"email"`
-			JobTitle       *string  `json:"jobTitle"`
-			Manager        *string  `json:"manager"`
-			Workgroup      *string  `json:"workgroup"`
-			Specialties    []string `json:"specialties"`
-			Certifications []string `json:"certifications"`
-			Active         *bool    `json:"active"`
+			Name           *string   `json:"name"`
+			Email          *string   `json:"email"`
+			JobTitle       *data.Ref `json:"jobTitle"`
+			Manager        *data.Ref `json:"manager"`
+			Workgroup      *data.Ref `json:"workgroup"`
+			Specialties    []string  `json:"specialties"`
+			Certifications []string  `json:"certifications"`
+			Active         *bool     `json:"active"`
 		}
 
 		err = api.readJSON(w, r, &input)
@@ -131,8 +142,14 @@ func (api *API) handleUpdateResource() http.HandlerFunc {
 
 		v := validator.New()
 
+		err = api.models.References.ResolveResource(v, resource)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
 		if data.ValidateResource(v, *resource); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
 			return
 		}
 
@@ -141,6 +158,8 @@ func (api *API) handleUpdateResource() http.HandlerFunc {
 			switch {
 			case errors.Is(err, data.ErrEditConflict):
 				api.editConflictResponse(w, r)
+			case errors.Is(err, data.ErrConstraintViolation):
+				api.constraintViolationResponse(w, r, err)
 			default:
 				api.serverErrorResponse(w, r, err)
 			}
@@ -158,6 +177,7 @@ func (api *API) handleListResources() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var input struct {
 			Name           string
+			NameMatch      string
 			Workgroups     []string
 			Clearance      string
 			Specialties    []string
@@ -172,6 +192,7 @@ func (api *API) handleListResources() http.HandlerFunc {
 		qs := r.URL.Query()
 
 		input.Name = api.readString(qs, "name", "")
+		input.NameMatch = api.readString(qs, "nameMatch", "exact")
 		input.Workgroups = api.readCSV(qs, "workgroups", []string{})
 		input.Clearance = api.readString(qs, "clearance", "")
 		input.Specialties = api.readCSV(qs, "specialties", []string{})
@@ -182,22 +203,160 @@ func (api *API) handleListResources() http.HandlerFunc {
 		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
 		input.Filters.Sort = api.readString(qs, "sort", "employee_id")
 		input.Filters.SortSafelist = []string{"employee_id", "name", "-employee_id", "-name"}
+		input.Filters.After = api.readCursor(qs, "after", v)
+		input.Filters.Before = api.readCursor(qs, "before", v)
+		input.Filters.SkipCount = !api.readBool(qs, "count", true, v)
+		input.Filters.Expr = data.ParseFilter(v, api.readString(qs, "filter", ""), data.ResourceFilterFields)
+
+		data.ValidateNameMatch(v, input.NameMatch)
 
 		if data.ValidateFilters(v, input.Filters); !v.Valid() {
-			api.failedValidationResponse(w, r, v.Errors)
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		if api.wantsCSV(r) {
+			err := writeCSVList(api, w, r, "resources", input.Filters, func(f data.Filters) ([]*data.Resource, data.Metadata, error) {
+				return api.models.Resources.GetAll(input.Name, input.NameMatch, input.Workgroups, input.Clearance,
+					input.Specialties, input.Certifications, input.Manager, input.Active, f)
+			})
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 
-		resources, metadata, err := api.models.Resources.GetAll(input.Name, input.Workgroups, input.Clearance,
+		resources, metadata, err := api.models.Resources.GetAll(input.Name, input.NameMatch, input.Workgroups, input.Clearance,
 			input.Specialties, input.Certifications, input.Manager, input.Active, input.Filters)
 		if err != nil {
 			api.serverErrorResponse(w, r, err)
 			return
 		}
 
+		api.setPageLinks(r, &metadata)
+
 		err = api.writeJSON(w, http.StatusOK, envelope{"resources": resources, "metadata": metadata}, nil)
 		if err != nil {
 			api.serverErrorResponse(w, r, err)
 		}
 	}
 }
+
+func (api *API) handleAutocompleteResources() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		q := api.readString(qs, "q", "")
+		limit := api.readInt(qs, "limit", 10, v)
+
+		if data.ValidateAutocomplete(v, q, limit); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		suggestions, err := api.models.Resources.Autocomplete(q, limit)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"resources": suggestions}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleShowResourceCertifications lists a resource's certifications with
+// their expiry dates, which drive the certification expiry notifications.
+func (api *API) handleShowResourceCertifications() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		_, err = api.models.Resources.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		certs, err := api.models.ResourceCertifications.GetAll(id)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"certifications": certs}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleUpdateResourceCertifications records when a resource's
+// certifications expire. Certifications themselves are added and removed
+// through the resource.
+func (api *API) handleUpdateResourceCertifications() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		resource, err := api.models.Resources.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		var input struct {
+			Certifications []data.ResourceCertification `json:"certifications"`
+		}
+
+		err = api.readJSON(w, r, &input)
+		if err != nil {
+			api.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateResourceCertifications(v, resource.Certifications, input.Certifications); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = api.models.ResourceCertifications.UpdateExpiry(id, input.Certifications)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		certs, err := api.models.ResourceCertifications.GetAll(id)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"certifications": certs}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
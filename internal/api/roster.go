@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// A reconciliation that would deactivate more than rosterLeaverShare of the
+// active resources, and more than rosterLeaverMin people, is more likely to
+// come from a truncated roster than from a wave of resignations, so it is
+// only confirmed with force=true.
+const (
+	rosterLeaverShare = 0.1
+	rosterLeaverMin   = 5
+)
+
+// readRoster reads an HR roster given either as an HR export with a text/csv
+// content type, in the same layout as a resource import, or as JSON in the
+// form {"roster": [...]}.
+func (api *API) readRoster(w http.ResponseWriter, r *http.Request, v *validator.Validator) ([]data.RosterEntry, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "text/csv" {
+		rows, err := data.ParseResourceCSV(http.MaxBytesReader(w, r.Body, importMaxBytes))
+		if err != nil {
+			return nil, err
+		}
+		return data.RosterFromImport(v, rows), nil
+	}
+
+	var input struct {
+		Roster []data.RosterEntry `json:"roster"`
+	}
+
+	err := api.readJSON(w, r, &input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", data.ErrInvalidImport, err)
+	}
+
+	return input.Roster, nil
+}
+
+// handleCreateRosterReconciliation compares the roster in the request body
+// with the resources on file and saves the report. Nothing else is changed
+// until the reconciliation is confirmed.
+func (api *API) handleCreateRosterReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := validator.New()
+
+		roster, err := api.readRoster(w, r, v)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+
+			switch {
+			case errors.As(err, &maxBytesError):
+				api.badRequestResponse(w, r, errors.New("body must not be larger than 10MB"))
+			case errors.Is(err, data.ErrInvalidImport):
+				api.badRequestResponse(w, r, err)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if data.ValidateRoster(v, roster); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		current, err := api.models.Roster.Current()
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		rec, err := api.models.Roster.Insert(data.ReconcileRoster(current, roster))
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/roster/reconciliations/%d", rec.ID))
+
+		err = api.writeJSON(w, http.StatusCreated, envelope{"reconciliation": rec}, headers)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleShowRosterReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := api.readRosterReconciliation(w, r)
+		if !ok {
+			return
+		}
+
+		err := api.writeJSON(w, http.StatusOK, envelope{"reconciliation": rec}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleConfirmRosterReconciliation applies the leavers found by a pending
+// reconciliation. A reconciliation can only be confirmed once.
+func (api *API) handleConfirmRosterReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := api.readRosterReconciliation(w, r)
+		if !ok {
+			return
+		}
+
+		v := validator.New()
+
+		force := api.readBool(r.URL.Query(), "force", false, v)
+		if !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		leavers := len(rec.Report.Leavers)
+		if !force && leavers > rosterLeaverMin && float64(leavers) > rosterLeaverShare*float64(rec.Report.Active) {
+			v.AddErrorCode("force", validator.CodeRequired, fmt.Sprintf(
+				"must be true to deactivate %d of %d active resources", leavers, rec.Report.Active))
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		rec, err := api.models.Roster.Confirm(rec.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			case errors.Is(err, data.ErrEditConflict):
+				api.editConflictResponse(w, r)
+			case errors.Is(err, data.ErrStaleReconciliation):
+				api.staleReconciliationResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"reconciliation": rec}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) readRosterReconciliation(w http.ResponseWriter, r *http.Request) (*data.RosterReconciliation, bool) {
+	id, err := api.readIDParam(r)
+	if err != nil || id < 1 {
+		api.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	rec, err := api.models.Roster.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotFound):
+			api.notFoundResponse(w, r)
+		default:
+			api.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return rec, true
+}
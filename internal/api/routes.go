@@ -6,19 +6,101 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+// router records the matched route pattern on each request, so that it can
+// be used in access logs, and applies the rate limit for that route unless
+// the router is unlimited. Routes added through a router with a feature
+// are only served while that feature flag is on.
+type router struct {
+	*httprouter.Router
+	api       *API
+	unlimited bool
+	feature   string
+}
+
+func (rt router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	if rt.feature != "" {
+		handler = rt.api.requireFeature(rt.feature, handler)
+	}
+	if !rt.unlimited {
+		handler = rt.api.rateLimit(path, handler)
+	}
+
+	rt.Router.HandlerFunc(method, path, func(w http.ResponseWriter, r *http.Request) {
+		rt.api.contextGetRequestInfo(r).route = path
+		handler(w, r)
+	})
+}
+
 func (api *API) routes() http.Handler {
-	router := httprouter.New()
+	router := router{Router: httprouter.New(), api: api}
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", api.handleHealthcheck())
+	// Probes come from the orchestrator and load balancers, often through
+	// the same address, and must not be turned away by the rate limit.
+	probes := router
+	probes.unlimited = true
+
+	probes.HandlerFunc(http.MethodGet, "/v1/healthcheck", api.handleHealthcheck())
+	probes.HandlerFunc(http.MethodGet, "/v1/healthz", api.handleLiveness())
+	probes.HandlerFunc(http.MethodGet, "/v1/readyz", api.handleReadiness())
 
 	router.HandlerFunc(http.MethodGet, "/v1/resources", api.handleListResources())
 	router.HandlerFunc(http.MethodPost, "/v1/resources", api.handleCreateResource())
+	router.HandlerFunc(http.MethodPost, "/v1/resources/import", api.handleImportResources())
+	router.HandlerFunc(http.MethodGet, "/v1/resources/autocomplete", api.handleAutocompleteResources())
 	router.HandlerFunc(http.MethodPatch, "/v1/resources/:id", api.handleUpdateResource())
 
+	router.HandlerFunc(http.MethodGet, "/v1/resource-certifications/:id", api.handleShowResourceCertifications())
+	router.HandlerFunc(http.MethodPut, "/v1/resource-certifications/:id", api.handleUpdateResourceCertifications())
+
+	router.HandlerFunc(http.MethodPost, "/v1/roster/reconciliations", api.handleCreateRosterReconciliation())
+	router.HandlerFunc(http.MethodGet, "/v1/roster/reconciliations/:id", api.handleShowRosterReconciliation())
+	router.HandlerFunc(http.MethodPost, "/v1/roster/reconciliations/:id/confirm", api.handleConfirmRosterReconciliation())
+
 	router.HandlerFunc(http.MethodGet, "/v1/projects", api.handleListProjects())
 	router.HandlerFunc(http.MethodPost, "/v1/projects", api.handleCreateProject())
 	router.HandlerFunc(http.MethodGet, "/v1/projects/:id", api.handleShowProject())
 	router.HandlerFunc(http.MethodPatch, "/v1/projects/:id", api.handleUpdateProject())
+	router.HandlerFunc(http.MethodGet, "/v1/projects/:id/sync-history", api.handleListProjectSyncHistory())
+
+	router.HandlerFunc(http.MethodPost, "/v1/changepoint/syncs", api.handleCreateChangepointSync())
+	router.HandlerFunc(http.MethodGet, "/v1/changepoint/syncs/:id", api.handleShowChangepointSync())
+	router.HandlerFunc(http.MethodGet, "/v1/changepoint/flags", api.handleListChangepointFlags())
+	router.HandlerFunc(http.MethodPost, "/v1/changepoint/flags/:id/resolve", api.handleResolveChangepointFlag())
+
+	search := router
+	search.feature = "search"
+
+	search.HandlerFunc(http.MethodGet, "/v1/search", api.handleSearch())
+
+	router.HandlerFunc(http.MethodGet, "/v1/notification-preferences/:id", api.handleShowNotificationPreferences())
+	router.HandlerFunc(http.MethodPut, "/v1/notification-preferences/:id", api.handleUpdateNotificationPreferences())
+
+	eventStream := router
+	eventStream.feature = "event-stream"
+
+	eventStream.HandlerFunc(http.MethodGet, "/v1/events/stream", api.handleEventStream())
+
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", api.handleListWebhooks())
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", api.handleCreateWebhook())
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", api.handleShowWebhook())
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", api.handleUpdateWebhook())
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", api.handleDeleteWebhook())
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", api.handleListWebhookDeliveries())
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/:id/deliveries/:delivery/replay", api.handleReplayWebhookDelivery())
+
+	return api.assignRequestID(api.logAccess(api.recoverPanic(api.enableCORS(router))))
+}
+
+// adminRoutes are served on the admin port, which is not exposed publicly,
+// so they are not rate limited.
+func (api *API) adminRoutes() http.Handler {
+	router := router{Router: httprouter.New(), api: api, unlimited: true}
+
+	router.Handler(http.MethodGet, "/metrics", api.metrics.registry.Handler())
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/jobs", api.handleListJobs())
+	router.HandlerFunc(http.MethodGet, "/v1/admin/jobs/:id", api.handleShowJob())
+	router.HandlerFunc(http.MethodPost, "/v1/admin/jobs/:id/retry", api.handleRetryJob())
 
-	return api.recoverPanic(api.enableCORS(router))
+	return api.assignRequestID(api.recoverPanic(router))
 }
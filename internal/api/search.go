@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+func (api *API) handleSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Query string
+			Types []string
+			Limit int
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Query = api.readString(qs, "q", "")
+		input.Types = api.readCSV(qs, "types", []string{})
+		input.Limit = api.readInt(qs, "limit", 20, v)
+
+		if data.ValidateSearch(v, input.Query, input.Types, input.Limit); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		hits, err := api.models.Search.Search(input.Query, input.Types, input.Limit)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"results": hits}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
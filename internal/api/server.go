@@ -20,6 +20,46 @@ func (api *API) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	var admin *http.Server
+	if api.cfg.Admin.Port != 0 {
+		admin = &http.Server{
+			Addr:         fmt.Sprintf(":%d", api.cfg.Admin.Port),
+			Handler:      api.adminRoutes(),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			api.logger.PrintInfo("starting admin server", map[string]any{
+				"addr": admin.Addr,
+			})
+
+			err := admin.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				api.logger.PrintError(err, map[string]any{"addr": admin.Addr})
+			}
+		}()
+	}
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-hup:
+				err := api.reloadConfig()
+				if err != nil {
+					api.logger.PrintError(err, map[string]any{"signal": "hangup"})
+				}
+			case <-api.quit:
+				return
+			}
+		}
+	}()
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -27,19 +67,40 @@ func (api *API) serve() error {
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		s := <-quit
 
-		api.logger.PrintInfo("caught signal", map[string]string{
+		api.logger.PrintInfo("caught signal", map[string]any{
 			"signal": s.String(),
 		})
 
+		// Readiness checks fail from here on. Requests keep being served
+		// until the load balancer has seen that and stopped sending them.
+		api.shuttingDown.Store(true)
+
+		shutdownDelay, _ := time.ParseDuration(api.cfg.ShutdownDelay)
+		if shutdownDelay > 0 {
+			api.logger.PrintInfo("delaying shutdown", map[string]any{
+				"delay": shutdownDelay.String(),
+			})
+			time.Sleep(shutdownDelay)
+		}
+
+		close(api.quit)
+
+		drainTimeout, _ := time.ParseDuration(api.cfg.Jobs.DrainTimeout)
+		api.drainJobs(drainTimeout)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		if admin != nil {
+			admin.Shutdown(ctx)
+		}
+
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
 		}
 
-		api.logger.PrintInfo("completing background tasks", map[string]string{
+		api.logger.PrintInfo("completing background tasks", map[string]any{
 			"addr": srv.Addr,
 		})
 
@@ -47,7 +108,7 @@ func (api *API) serve() error {
 		shutdownError <- nil
 	}()
 
-	api.logger.PrintInfo("starting server", map[string]string{
+	api.logger.PrintInfo("starting server", map[string]any{
 		"addr": srv.Addr,
 		"env":  api.cfg.Env,
 	})
@@ -62,7 +123,7 @@ func (api *API) serve() error {
 		return err
 	}
 
-	api.logger.PrintInfo("server stopper", map[string]string{
+	api.logger.PrintInfo("server stopper", map[string]any{
 		"addr": srv.Addr,
 	})
 
@@ -0,0 +1,478 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/vmw-pso/back-end/internal/data"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	webhookDispatchInterval = 5 * time.Second
+	webhookDispatchBatch    = 100
+	webhookTimeout          = 10 * time.Second
+	webhookResponseDrain    = 4096
+)
+
+// newWebhookClient returns the client deliveries are sent with. It does not
+// follow redirects, or use a proxy, and unless allowPrivate is set it will
+// only connect to public addresses. The address is checked as the
+// connection is made, after DNS resolution, so a host name that resolves,
+// or later rebinds, to an internal address is refused as well.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !data.IsPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type deliverWebhookPayload struct {
+	ID int64 `json:"id"`
+}
+
+// registerWebhookJobs sets up outbound webhooks. Database triggers record
+// every change to projects, resources, requests, comments and assignments;
+// the dispatcher creates a delivery for each subscribed webhook, and a job
+// sends it, retrying with backoff until the endpoint accepts it.
+func (api *API) registerWebhookJobs() error {
+	registerJob(api, "webhook.deliver", func(ctx context.Context, p deliverWebhookPayload) error {
+		delivery, err := api.models.Webhooks.GetDelivery(p.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if delivery.Status == data.WebhookDeliverySucceeded {
+			return nil
+		}
+
+		webhook, err := api.models.Webhooks.Get(delivery.WebhookID)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !webhook.Active {
+			return nil
+		}
+
+		attempt := api.deliverWebhook(ctx, webhook, delivery)
+		if err := api.models.Webhooks.RecordAttempt(delivery.ID, attempt); err != nil && attempt.Err == nil {
+			return err
+		}
+		return attempt.Err
+	})
+
+	return nil
+}
+
+func (api *API) dispatchWebhooks() error {
+	for {
+		n, err := api.models.Webhooks.Dispatch(webhookDispatchBatch, "webhook.deliver")
+		if err != nil || n < webhookDispatchBatch {
+			return err
+		}
+	}
+}
+
+// deliverWebhook POSTs the delivery's event to the webhook. The body is
+// signed with the webhook's secret: X-PSO-Signature is the hex HMAC-SHA256
+// of the X-PSO-Timestamp value, a ".", and the body, so that receivers can
+// both verify the sender and reject replayed requests.
+func (api *API) deliverWebhook(ctx context.Context, webhook *data.Webhook, delivery *data.WebhookDelivery) data.WebhookAttempt {
+	var attempt data.WebhookAttempt
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pso-webhooks/"+version)
+	req.Header.Set("X-PSO-Event", delivery.Event.Type)
+	req.Header.Set("X-PSO-Event-ID", strconv.FormatInt(delivery.Event.ID, 10))
+	req.Header.Set("X-PSO-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-PSO-Timestamp", timestamp)
+	req.Header.Set("X-PSO-Signature", "sha256="+signWebhook(webhook.Secret, timestamp, body))
+
+	start := time.Now()
+	res, err := api.hooks.Do(req)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Err = err
+		return attempt
+	}
+	defer res.Body.Close()
+
+	// The response body is not kept: only the status is of use, and
+	// showing the body would turn webhooks into a way to read other
+	// services. A short body is read so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, webhookResponseDrain))
+	attempt.ResponseStatus = res.StatusCode
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Err = fmt.Errorf("webhook responded with %s", res.Status)
+	}
+
+	return attempt
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (api *API) readWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := api.readIDParam(r)
+	if err != nil || id < 1 {
+		api.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	webhook, err := api.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotFound):
+			api.notFoundResponse(w, r)
+		default:
+			api.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+func (api *API) handleListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			data.Filters
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Filters.Page = api.readInt(qs, "page", 1, v)
+		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
+		input.Filters.Sort = api.readString(qs, "sort", "webhook_id")
+		input.Filters.SortSafelist = []string{"webhook_id", "url", "created_at", "-webhook_id", "-url", "-created_at"}
+
+		if data.ValidateFilters(v, input.Filters); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		if api.wantsCSV(r) {
+			err := writeCSVList(api, w, r, "webhooks", input.Filters, api.models.Webhooks.GetAll)
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		webhooks, metadata, err := api.models.Webhooks.GetAll(input.Filters)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks, "metadata": metadata}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleCreateWebhook returns the signing secret, which is generated if the
+// client does not supply one. It is not shown again.
+func (api *API) handleCreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			URL        string   `json:"url"`
+			Secret     string   `json:"secret"`
+			EventTypes []string `json:"eventTypes"`
+			Active     *bool    `json:"active"`
+		}
+
+		err := api.readJSON(w, r, &input)
+		if err != nil {
+			api.badRequestResponse(w, r, err)
+			return
+		}
+
+		webhook := &data.Webhook{
+			URL:        input.URL,
+			Secret:     input.Secret,
+			EventTypes: input.EventTypes,
+			Active:     input.Active == nil || *input.Active,
+		}
+
+		if webhook.Secret == "" {
+			webhook.Secret, err = newWebhookSecret()
+			if err != nil {
+				api.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		v := validator.New()
+
+		if data.ValidateWebhook(v, webhook, api.cfg.Webhooks.AllowPrivate); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = api.models.Webhooks.Insert(webhook)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+		err = api.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook, "secret": webhook.Secret}, headers)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleShowWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := api.readWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		err := api.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleUpdateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := api.readWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			URL        *string  `json:"url"`
+			Secret     *string  `json:"secret"`
+			EventTypes []string `json:"eventTypes"`
+			Active     *bool    `json:"active"`
+		}
+
+		err := api.readJSON(w, r, &input)
+		if err != nil {
+			api.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.URL != nil {
+			webhook.URL = *input.URL
+		}
+
+		if input.Secret != nil {
+			webhook.Secret = *input.Secret
+		}
+
+		if input.EventTypes != nil {
+			webhook.EventTypes = input.EventTypes
+		}
+
+		if input.Active != nil {
+			webhook.Active = *input.Active
+		}
+
+		v := validator.New()
+
+		if data.ValidateWebhook(v, webhook, api.cfg.Webhooks.AllowPrivate); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		err = api.models.Webhooks.Update(webhook)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				api.editConflictResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleDeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.readIDParam(r)
+		if err != nil || id < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		err = api.models.Webhooks.Delete(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (api *API) handleListWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := api.readWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Status string
+			data.Filters
+		}
+
+		v := validator.New()
+
+		qs := r.URL.Query()
+
+		input.Status = api.readString(qs, "status", "")
+		input.Filters.Page = api.readInt(qs, "page", 1, v)
+		input.Filters.PageSize = api.readInt(qs, "pageSize", 20, v)
+		input.Filters.Sort = api.readString(qs, "sort", "-delivery_id")
+		input.Filters.SortSafelist = []string{"delivery_id", "attempted_at", "-delivery_id", "-attempted_at"}
+
+		data.ValidateWebhookDeliveryStatus(v, input.Status)
+		if data.ValidateFilters(v, input.Filters); !v.Valid() {
+			api.failedValidationResponse(w, r, v)
+			return
+		}
+
+		deliveries, metadata, err := api.models.Webhooks.GetDeliveries(webhook.ID, input.Status, input.Filters)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// handleReplayWebhookDelivery sends the event from an earlier delivery
+// again, whatever the outcome of that delivery.
+func (api *API) handleReplayWebhookDelivery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookID, err := api.readIDParam(r)
+		if err != nil || webhookID < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		deliveryID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("delivery"), 10, 64)
+		if err != nil || deliveryID < 1 {
+			api.notFoundResponse(w, r)
+			return
+		}
+
+		delivery, err := api.models.Webhooks.Replay(webhookID, deliveryID, "webhook.deliver")
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNotFound):
+				api.notFoundResponse(w, r)
+			default:
+				api.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = api.writeJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+		if err != nil {
+			api.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// workerStatus is shown by the public readiness probe, so a failed run is
+// reported only as failed. The error itself is logged by runWorker.
+type workerStatus struct {
+	Interval      string    `json:"interval"`
+	LastRun       time.Time `json:"lastRun,omitempty"`
+	LastRunFailed bool      `json:"lastRunFailed"`
+	Running       bool      `json:"running"`
+}
+
+type workerRegistry struct {
+	mu       sync.Mutex
+	statuses map[string]*workerStatus
+}
+
+func (wr *workerRegistry) set(name string, update func(*workerStatus)) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.statuses == nil {
+		wr.statuses = make(map[string]*workerStatus)
+	}
+
+	status, ok := wr.statuses[name]
+	if !ok {
+		status = &workerStatus{}
+		wr.statuses[name] = status
+	}
+	update(status)
+}
+
+func (wr *workerRegistry) snapshot() map[string]workerStatus {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	snapshot := make(map[string]workerStatus, len(wr.statuses))
+	for name, status := range wr.statuses {
+		snapshot[name] = *status
+	}
+	return snapshot
+}
+
+// runWorker calls fn every interval in the background until the server shuts
+// down, recording the outcome of each run for the readiness probe.
+func (api *API) runWorker(name string, interval time.Duration, fn func() error) {
+	api.workers.set(name, func(s *workerStatus) {
+		s.Interval = interval.String()
+		s.Running = true
+	})
+
+	api.background(name, func() {
+		defer api.workers.set(name, func(s *workerStatus) { s.Running = false })
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-api.quit:
+				return
+			case <-ticker.C:
+				err := fn()
+				api.workers.set(name, func(s *workerStatus) {
+					s.LastRun = time.Now()
+					s.LastRunFailed = err != nil
+				})
+				if err != nil {
+					api.logger.PrintError(err, map[string]any{"worker": name})
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"0 6 * * *", true},
+		{"*/15 0-6,18-23 1,15 * 1-5", true},
+		{"0-30/5 * * * *", true},
+		{"5/10 * * * *", true},
+		{"59 23 31 12 6", true},
+		{"@hourly", true},
+		{"@daily", true},
+		{"@weekly", true},
+		{"@monthly", true},
+		{" @daily ", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 0 *", false},
+		{"* * * 13 *", false},
+		{"* * * * 7", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"1-b * * * *", false},
+		{"1,,2 * * * *", false},
+		{"@yearly", false},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if tt.valid && err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.spec, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Parse(%q) returned no error", tt.spec)
+		}
+	}
+}
+
+func minute(t *testing.T, s string) time.Time {
+	t.Helper()
+
+	tm, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		from string
+		want string
+	}{
+		{"every minute", "* * * * *", "2026-03-10 09:15", "2026-03-10 09:16"},
+		{"later today", "0 6 * * *", "2026-03-10 05:59", "2026-03-10 06:00"},
+		{"strictly after", "0 6 * * *", "2026-03-10 06:00", "2026-03-11 06:00"},
+		{"hourly", "@hourly", "2026-03-10 09:15", "2026-03-10 10:00"},
+		{"step", "*/20 * * * *", "2026-03-10 09:41", "2026-03-10 10:00"},
+		{"day rollover", "30 23 * * *", "2026-03-10 23:45", "2026-03-11 23:30"},
+		{"month rollover", "0 0 * * *", "2026-01-31 12:00", "2026-02-01 00:00"},
+		{"year rollover", "0 0 1 * *", "2026-12-15 00:00", "2027-01-01 00:00"},
+		{"month restricted", "0 0 1 6 *", "2026-07-01 00:00", "2027-06-01 00:00"},
+		{"short month skipped", "0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"leap day", "0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"day of week", "0 9 * * 1", "2026-03-10 09:00", "2026-03-16 09:00"},
+		{"sunday", "0 0 * * 0", "2026-03-10 00:00", "2026-03-15 00:00"},
+		{"dom or dow, dom first", "0 0 13 * 5", "2026-03-10 00:00", "2026-03-13 00:00"},
+		{"dom or dow, dow first", "0 0 20 * 3", "2026-03-10 00:00", "2026-03-11 00:00"},
+		{"dom and star dow", "0 0 20 * *", "2026-03-10 00:00", "2026-03-20 00:00"},
+		{"star dom and dow", "0 0 * * 3", "2026-03-12 00:00", "2026-03-18 00:00"},
+		{"stepped dom counts as star", "0 0 */10 * 3", "2026-03-10 00:00", "2026-03-11 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.spec, err)
+			}
+
+			from := minute(t, tt.from)
+			got := s.Next(from)
+			if want := minute(t, tt.want); !got.Equal(want) {
+				t.Errorf("Next(%s) for %q = %s, want %s", from, tt.spec, got, want)
+			}
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next for 30 February = %s, want the zero time", got)
+	}
+}
@@ -0,0 +1,1089 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	ProjectSyncUpdated   = "updated"
+	ProjectSyncUnchanged = "unchanged"
+	ProjectSyncFlagged   = "flagged"
+	ProjectSyncUnmatched = "unmatched"
+
+	ProjectSyncFlagPending  = "pending"
+	ProjectSyncFlagAccepted = "accepted"
+	ProjectSyncFlagRejected = "rejected"
+)
+
+var ProjectSyncFlagStatuses = []string{ProjectSyncFlagPending, ProjectSyncFlagAccepted, ProjectSyncFlagRejected}
+
+// ErrFlagNotApplicable is returned when a flagged ChangePoint value is
+// accepted but still cannot be written to the project, such as a project
+// manager who is not on file.
+var ErrFlagNotApplicable = errors.New("changepoint value cannot be applied")
+
+// changepointFields are the project fields kept in step with ChangePoint,
+// in the order they are compared.
+var changepointFields = []string{"name", "customer", "projectManager", "status"}
+
+// changepointColumns maps the headings, or JSON keys, used by ChangePoint
+// exports, lower-cased with spaces and punctuation removed, to the field
+// they fill.
+var changepointColumns = map[string]string{
+	"changepointid":      "changepointId",
+	"changepoint":        "changepointId",
+	"projectid":          "changepointId",
+	"projectcode":        "changepointId",
+	"opportunityid":      "opportunityId",
+	"opportunity":        "opportunityId",
+	"opportunitynumber":  "opportunityId",
+	"sfdcopportunityid":  "opportunityId",
+	"name":               "name",
+	"projectname":        "name",
+	"customer":           "customer",
+	"customername":       "customer",
+	"client":             "customer",
+	"accountname":        "customer",
+	"projectmanager":     "projectManager",
+	"projectmanagername": "projectManager",
+	"pm":                 "projectManager",
+	"status":             "status",
+	"projectstatus":      "status",
+	"projectstatusname":  "status",
+	"engagementstatus":   "status",
+}
+
+// changepointStatuses maps ChangePoint project statuses that are not also
+// project statuses here to the nearest one.
+var changepointStatuses = map[string]string{
+	"active":      "Work in progress",
+	"in progress": "Work in progress",
+	"open":        "Work in progress",
+	"on hold":     "Inactive",
+	"suspended":   "Inactive",
+	"closed":      "Complete",
+	"completed":   "Complete",
+	"proposed":    "Staged",
+	"pipeline":    "Staged",
+	"not started": "Staged",
+}
+
+// ChangepointRow is one project from a ChangePoint export.
+type ChangepointRow struct {
+	Line           int    `json:"line"`
+	ChangepointID  string `json:"changepointId"`
+	OpportunityID  string `json:"opportunityId"`
+	Name           string `json:"name"`
+	Customer       string `json:"customer"`
+	ProjectManager string `json:"projectManager"`
+	Status         string `json:"status"`
+}
+
+func (r ChangepointRow) field(name string) string {
+	switch name {
+	case "name":
+		return r.Name
+	case "customer":
+		return r.Customer
+	case "projectManager":
+		return r.ProjectManager
+	case "status":
+		return r.Status
+	default:
+		return ""
+	}
+}
+
+func newChangepointRow(line int, values map[string]string) ChangepointRow {
+	return ChangepointRow{
+		Line:           line,
+		ChangepointID:  strings.TrimSpace(values["changepointId"]),
+		OpportunityID:  strings.TrimSpace(values["opportunityId"]),
+		Name:           strings.TrimSpace(values["name"]),
+		Customer:       strings.TrimSpace(values["customer"]),
+		ProjectManager: strings.TrimSpace(values["projectManager"]),
+		Status:         strings.TrimSpace(values["status"]),
+	}
+}
+
+// ProjectSyncChange is a field that differed between ChangePoint and the
+// project. Applied is false when the ChangePoint value was flagged for
+// review instead of written.
+type ProjectSyncChange struct {
+	Field   string `json:"field"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Applied bool   `json:"applied"`
+	Note    string `json:"note,omitempty"`
+}
+
+// ProjectSyncEntry records what a sync did with one row of the export.
+// Rows that matched a project and changed nothing are counted but not
+// recorded.
+type ProjectSyncEntry struct {
+	ID            int64               `json:"id"`
+	SyncID        int64               `json:"syncId"`
+	OpportunityID string              `json:"opportunityId,omitempty"`
+	ChangepointID string              `json:"changepointId,omitempty"`
+	Line          int                 `json:"line"`
+	Outcome       string              `json:"outcome"`
+	Changes       []ProjectSyncChange `json:"changes"`
+	Note          string              `json:"note,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+// ProjectSyncFlag is a ChangePoint value waiting for someone to accept or
+// reject it. A project has at most one pending flag per field; a later
+// sync that brings a different value replaces it.
+type ProjectSyncFlag struct {
+	ID               int64      `json:"id"`
+	SyncID           int64      `json:"syncId"`
+	OpportunityID    string     `json:"opportunityId"`
+	Field            string     `json:"field"`
+	LocalValue       string     `json:"localValue"`
+	ChangepointValue string     `json:"changepointValue"`
+	Note             string     `json:"note,omitempty"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	ResolvedAt       *time.Time `json:"resolvedAt,omitempty"`
+}
+
+type ChangepointSync struct {
+	ID        int64               `json:"id"`
+	Source    string              `json:"source"`
+	Rows      int                 `json:"rows"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Flagged   int                 `json:"flagged"`
+	Unmatched int                 `json:"unmatched"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Entries   []*ProjectSyncEntry `json:"entries,omitempty"`
+}
+
+func ValidateProjectSyncFlagStatus(v *validator.Validator, status string) {
+	if status != "" {
+		v.CheckCode(validator.PermittedValue(status, ProjectSyncFlagStatuses...), "status", validator.CodeNotPermitted, "invalid status value")
+	}
+}
+
+// ParseChangepointCSV reads a ChangePoint project export. Columns are
+// matched by heading and unknown columns are ignored. Rows may have more
+// fields than the headings but not fewer, as a short row is most likely a
+// truncated export.
+func ParseChangepointCSV(r io.Reader) ([]ChangepointRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	headings, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: file is empty", ErrInvalidImport)
+		}
+		return nil, importReadError(err)
+	}
+
+	columns := make(map[string]int)
+	for i, heading := range headings {
+		if i == 0 {
+			heading = strings.TrimPrefix(heading, "\ufeff")
+		}
+		if field := changepointColumns[normaliseHeading(heading)]; field != "" {
+			if _, exists := columns[field]; !exists {
+				columns[field] = i
+			}
+		}
+	}
+
+	_, hasChangepointID := columns["changepointId"]
+	_, hasOpportunityID := columns["opportunityId"]
+	if !hasChangepointID && !hasOpportunityID {
+		return nil, fmt.Errorf("%w: missing column for changepoint id or opportunity id", ErrInvalidImport)
+	}
+
+	rows := []ChangepointRow{}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, importReadError(err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		if len(record) < len(headings) {
+			return nil, fmt.Errorf("%w: line %d has %d fields, expected %d", ErrInvalidImport, line, len(record), len(headings))
+		}
+
+		values := make(map[string]string, len(columns))
+		for field, i := range columns {
+			if i < len(record) {
+				values[field] = record[i]
+			}
+		}
+
+		rows = append(rows, newChangepointRow(line, values))
+	}
+
+	return rows, nil
+}
+
+// ParseChangepointJSON reads a ChangePoint project export given as a JSON
+// array of projects, or an object holding the array under "projects". Keys
+// are matched in the same way as CSV headings. Line is the position of the
+// project in the array, counting from one.
+func ParseChangepointJSON(r io.Reader) ([]ChangepointRow, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var doc json.RawMessage
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: file is empty", ErrInvalidImport)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	var projects []map[string]any
+
+	if bytes.HasPrefix(bytes.TrimSpace(doc), []byte("{")) {
+		var wrapper struct {
+			Projects json.RawMessage `json:"projects"`
+		}
+		if err := json.Unmarshal(doc, &wrapper); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		if wrapper.Projects == nil {
+			return nil, fmt.Errorf("%w: missing projects", ErrInvalidImport)
+		}
+		doc = wrapper.Projects
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&projects); err != nil {
+		return nil, fmt.Errorf("%w: projects must be an array of objects", ErrInvalidImport)
+	}
+
+	rows := make([]ChangepointRow, 0, len(projects))
+
+	for i, project := range projects {
+		values := make(map[string]string)
+		for key, value := range project {
+			field := changepointColumns[normaliseHeading(key)]
+			if field == "" {
+				continue
+			}
+			switch value := value.(type) {
+			case nil:
+			case string:
+				values[field] = value
+			case json.Number:
+				values[field] = value.String()
+			default:
+				return nil, fmt.Errorf("%w: project %d: %s must be a string", ErrInvalidImport, i+1, key)
+			}
+		}
+
+		rows = append(rows, newChangepointRow(i+1, values))
+	}
+
+	return rows, nil
+}
+
+// changepointStatus returns the project status for a ChangePoint status,
+// which may be one of statuses itself or one of changepointStatuses.
+func changepointStatus(s string, statuses []string) (string, bool) {
+	for _, status := range statuses {
+		if strings.EqualFold(status, s) {
+			return status, true
+		}
+	}
+
+	if status, ok := changepointStatuses[strings.ToLower(s)]; ok && validator.PermittedValue(status, statuses...) {
+		return status, true
+	}
+
+	return "", false
+}
+
+func sameValue(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// syncProject is a project as a sync sees it: its ChangePoint fields by
+// name, and the values ChangePoint last gave for them.
+type syncProject struct {
+	opportunityID string
+	changepointID string
+	values        map[string]string
+	baseline      map[string]string
+}
+
+// projectSyncPlan is what a sync will do to one project for one row.
+// updates holds database values by field; projectManager is an employee
+// ID.
+type projectSyncPlan struct {
+	entry    ProjectSyncEntry
+	updates  map[string]any
+	flags    []ProjectSyncFlag
+	baseline map[string]string
+}
+
+// planProjectSync compares a row with the project it matched. A field is
+// only written when the project still holds the value ChangePoint last
+// gave, or has none; if it has been edited here since, the new ChangePoint
+// value is flagged for review. A ChangePoint value that has not changed
+// since the last sync is ignored, so local edits are not reverted or
+// flagged over and over.
+func planProjectSync(row ChangepointRow, p *syncProject, statuses []string, managers map[string][]int64) projectSyncPlan {
+	plan := projectSyncPlan{
+		entry:    ProjectSyncEntry{OpportunityID: p.opportunityID, ChangepointID: p.changepointID, Line: row.Line, Changes: []ProjectSyncChange{}},
+		updates:  make(map[string]any),
+		baseline: make(map[string]string),
+	}
+
+	for _, field := range changepointFields {
+		incoming := row.field(field)
+		if incoming == "" {
+			continue
+		}
+
+		value := incoming
+		var dbValue any = incoming
+		var note string
+
+		switch field {
+		case "status":
+			if status, ok := changepointStatus(incoming, statuses); ok {
+				value, dbValue = status, status
+			} else {
+				dbValue, note = nil, "is not a project status"
+			}
+		case "projectManager":
+			switch ids := managers[strings.ToLower(incoming)]; len(ids) {
+			case 1:
+				dbValue = ids[0]
+			case 0:
+				dbValue, note = nil, "is not a resource on file"
+			default:
+				dbValue, note = nil, "matches more than one resource"
+			}
+		}
+
+		plan.baseline[field] = value
+		local := p.values[field]
+
+		if sameValue(value, local) {
+			continue
+		}
+
+		previous, synced := p.baseline[field]
+		if synced && sameValue(previous, value) {
+			continue
+		}
+
+		change := ProjectSyncChange{Field: field, From: local, To: value}
+
+		if dbValue != nil && (local == "" || (synced && sameValue(previous, local))) {
+			change.Applied = true
+			plan.updates[field] = dbValue
+		} else {
+			switch {
+			case note != "":
+			case synced:
+				note = "has been changed here since the last sync"
+			default:
+				note = "differs and has not been synced before"
+			}
+
+			change.Note = note
+			plan.flags = append(plan.flags, ProjectSyncFlag{
+				OpportunityID:    p.opportunityID,
+				Field:            field,
+				LocalValue:       local,
+				ChangepointValue: value,
+				Note:             note,
+			})
+		}
+
+		plan.entry.Changes = append(plan.entry.Changes, change)
+	}
+
+	return plan
+}
+
+func (plan *projectSyncPlan) outcome() string {
+	switch {
+	case len(plan.flags) > 0:
+		return ProjectSyncFlagged
+	case len(plan.updates) > 0:
+		return ProjectSyncUpdated
+	default:
+		return ProjectSyncUnchanged
+	}
+}
+
+type ChangepointModel struct {
+	DB *sql.DB
+}
+
+// Sync brings projects into line with a ChangePoint export in a single
+// transaction, matching rows on changepoint_id and then opportunity_id. A
+// project matched on opportunity_id that has no changepoint_id is linked
+// to the row's; one linked to a different ChangePoint project is flagged
+// and left alone, and not flagged again until ChangePoint gives it another
+// id. Rows that match no project are reported but projects are not created
+// from them.
+func (m *ChangepointModel) Sync(source string, rows []ChangepointRow) (*ChangepointSync, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Syncs from the scheduler and from uploads take turns, so each sees
+	// the baseline the one before it left.
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('changepoint_sync'))`)
+	if err != nil {
+		return nil, err
+	}
+
+	byOpportunity, byChangepoint, err := loadSyncProjects(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := loadProjectStatuses(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.ProjectManager != "" {
+			names = append(names, strings.ToLower(row.ProjectManager))
+		}
+	}
+
+	managers, err := loadResourceIDsByName(ctx, tx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ChangepointSync{Source: source, Rows: len(rows), Entries: []*ProjectSyncEntry{}}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO changepoint_sync (source, row_count, updated, unchanged, flagged, unmatched)
+		VALUES ($1, $2, 0, 0, 0, 0)
+		RETURNING sync_id, created_at`, source, len(rows)).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		var byCP, byOpp *syncProject
+		if row.ChangepointID != "" {
+			byCP = byChangepoint[row.ChangepointID]
+		}
+		if row.OpportunityID != "" {
+			byOpp = byOpportunity[row.OpportunityID]
+		}
+
+		entry := &ProjectSyncEntry{SyncID: s.ID, ChangepointID: row.ChangepointID, Line: row.Line, Changes: []ProjectSyncChange{}}
+
+		switch {
+		case row.ChangepointID == "" && row.OpportunityID == "":
+			entry.Outcome = ProjectSyncUnmatched
+			entry.Note = "has neither a changepoint id nor an opportunity id"
+		case byCP == nil && byOpp == nil:
+			entry.Outcome = ProjectSyncUnmatched
+			entry.Note = fmt.Sprintf("no project has changepoint id %q or opportunity id %q", row.ChangepointID, row.OpportunityID)
+		case byOpp != nil && row.ChangepointID != "" && byOpp.changepointID != row.ChangepointID && (byCP != nil || byOpp.changepointID != "") &&
+			sameValue(byOpp.baseline["changepointId"], row.ChangepointID):
+			// The conflict has been flagged before and ChangePoint has not
+			// changed the id since, so it is left to that flag.
+			entry.OpportunityID = byOpp.opportunityID
+			entry.Outcome = ProjectSyncUnchanged
+		case byOpp != nil && row.ChangepointID != "" && byOpp.changepointID != row.ChangepointID && (byCP != nil || byOpp.changepointID != ""):
+			flag := ProjectSyncFlag{
+				OpportunityID:    byOpp.opportunityID,
+				Field:            "changepointId",
+				LocalValue:       byOpp.changepointID,
+				ChangepointValue: row.ChangepointID,
+				Note:             "the project is linked to a different changepoint id",
+			}
+			if byCP != nil {
+				flag.Note = fmt.Sprintf("the changepoint id is linked to opportunity %s", byCP.opportunityID)
+			}
+
+			err = insertProjectSyncFlag(ctx, tx, s.ID, flag)
+			if err != nil {
+				return nil, err
+			}
+
+			err = updateChangepointBaseline(ctx, tx, byOpp.opportunityID, map[string]string{"changepointId": row.ChangepointID})
+			if err != nil {
+				return nil, err
+			}
+			byOpp.baseline["changepointId"] = row.ChangepointID
+
+			entry.OpportunityID = byOpp.opportunityID
+			entry.Outcome = ProjectSyncFlagged
+			entry.Changes = append(entry.Changes, ProjectSyncChange{
+				Field: flag.Field,
+				From:  flag.LocalValue,
+				To:    flag.ChangepointValue,
+				Note:  flag.Note,
+			})
+		default:
+			p := byCP
+			if p == nil {
+				p = byOpp
+			}
+
+			plan := planProjectSync(row, p, statuses, managers)
+
+			if p.changepointID == "" && row.ChangepointID != "" {
+				plan.updates["changepointId"] = row.ChangepointID
+				plan.entry.Changes = append([]ProjectSyncChange{{Field: "changepointId", To: row.ChangepointID, Applied: true}},
+					plan.entry.Changes...)
+				p.changepointID = row.ChangepointID
+				byChangepoint[row.ChangepointID] = p
+			}
+
+			if row.ChangepointID != "" {
+				plan.baseline["changepointId"] = row.ChangepointID
+			}
+
+			if byCP != nil && row.OpportunityID != "" && row.OpportunityID != p.opportunityID {
+				plan.entry.Note = fmt.Sprintf("opportunity id %q differs; matched on changepoint id", row.OpportunityID)
+			}
+
+			err = updateProjectFields(ctx, tx, p.opportunityID, plan.updates)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, flag := range plan.flags {
+				if err := insertProjectSyncFlag(ctx, tx, s.ID, flag); err != nil {
+					return nil, err
+				}
+			}
+
+			if len(plan.baseline) > 0 {
+				err = updateChangepointBaseline(ctx, tx, p.opportunityID, plan.baseline)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for field, value := range plan.baseline {
+				p.baseline[field] = value
+			}
+			for field := range plan.updates {
+				if field != "changepointId" {
+					p.values[field] = plan.baseline[field]
+				}
+			}
+
+			*entry = plan.entry
+			entry.SyncID = s.ID
+			entry.Outcome = plan.outcome()
+		}
+
+		switch entry.Outcome {
+		case ProjectSyncUpdated:
+			s.Updated++
+		case ProjectSyncUnchanged:
+			s.Unchanged++
+			continue
+		case ProjectSyncFlagged:
+			s.Flagged++
+		case ProjectSyncUnmatched:
+			s.Unmatched++
+		}
+
+		err = insertProjectSyncEntry(ctx, tx, entry)
+		if err != nil {
+			return nil, err
+		}
+		s.Entries = append(s.Entries, entry)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE changepoint_sync SET updated=$2, unchanged=$3, flagged=$4, unmatched=$5
+		WHERE sync_id=$1`, s.ID, s.Updated, s.Unchanged, s.Flagged, s.Unmatched)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func loadSyncProjects(ctx context.Context, tx *sql.Tx) (map[string]*syncProject, map[string]*syncProject, error) {
+	query := `
+		SELECT p.opportunity_id, COALESCE(p.changepoint_id, ''), p.name, p.customer,
+			COALESCE(r.name, ''), COALESCE(ps.status, ''), COALESCE(b.fields, '{}')
+		FROM project p
+			LEFT JOIN resource r ON r.employee_id=p.project_manager_id
+			LEFT JOIN project_status ps ON ps.status_id=p.status_id
+			LEFT JOIN changepoint_baseline b ON b.opportunity_id=p.opportunity_id`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byOpportunity := make(map[string]*syncProject)
+	byChangepoint := make(map[string]*syncProject)
+
+	for rows.Next() {
+		var (
+			name, customer, manager, status string
+			baseline                        []byte
+		)
+
+		p := &syncProject{}
+
+		err := rows.Scan(&p.opportunityID, &p.changepointID, &name, &customer, &manager, &status, &baseline)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p.values = map[string]string{"name": name, "customer": customer, "projectManager": manager, "status": status}
+
+		if err := json.Unmarshal(baseline, &p.baseline); err != nil {
+			return nil, nil, err
+		}
+
+		byOpportunity[p.opportunityID] = p
+		if p.changepointID != "" {
+			byChangepoint[p.changepointID] = p
+		}
+	}
+
+	return byOpportunity, byChangepoint, rows.Err()
+}
+
+func loadProjectStatuses(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT status FROM project_status ORDER BY status_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, rows.Err()
+}
+
+// loadResourceIDsByName returns the employee IDs of the resources with each
+// of names, which must be lower case, keyed by name.
+func loadResourceIDsByName(ctx context.Context, tx *sql.Tx, names []string) (map[string][]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT lower(name), employee_id
+		FROM resource
+		WHERE lower(name) = ANY($1)
+		ORDER BY employee_id`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string][]int64)
+	for rows.Next() {
+		var (
+			name string
+			id   int64
+		)
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, err
+		}
+		ids[name] = append(ids[name], id)
+	}
+
+	return ids, rows.Err()
+}
+
+// updateProjectFields writes the ChangePoint fields in updates, keyed by
+// field name, to a project.
+func updateProjectFields(ctx context.Context, tx *sql.Tx, opportunityID string, updates map[string]any) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	args := []any{opportunityID}
+	set := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		args = append(args, updates[field])
+		n := len(args)
+
+		switch field {
+		case "changepointId":
+			set = append(set, fmt.Sprintf("changepoint_id=$%d", n))
+		case "name":
+			set = append(set, fmt.Sprintf("name=$%d", n))
+		case "customer":
+			set = append(set, fmt.Sprintf("customer=$%d", n))
+		case "projectManager":
+			set = append(set, fmt.Sprintf("project_manager_id=$%d", n))
+		case "status":
+			set = append(set, fmt.Sprintf("status_id=(SELECT status_id FROM project_status WHERE status=$%d)", n))
+		default:
+			return fmt.Errorf("unknown project sync field %q", field)
+		}
+	}
+
+	query := fmt.Sprintf(`UPDATE project SET %s WHERE opportunity_id=$1`, strings.Join(set, ", "))
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return constraintError(err)
+}
+
+// updateChangepointBaseline records the values ChangePoint last gave for a
+// project's fields, keeping those for any other fields.
+func updateChangepointBaseline(ctx context.Context, tx *sql.Tx, opportunityID string, fields map[string]string) error {
+	baseline, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO changepoint_baseline (opportunity_id, fields)
+		VALUES ($1, $2)
+		ON CONFLICT (opportunity_id) DO UPDATE
+		SET fields=changepoint_baseline.fields || EXCLUDED.fields, synced_at=now()`,
+		opportunityID, string(baseline))
+	return err
+}
+
+func insertProjectSyncFlag(ctx context.Context, tx *sql.Tx, syncID int64, flag ProjectSyncFlag) error {
+	query := `
+		INSERT INTO project_sync_flag (sync_id, opportunity_id, field, local_value, changepoint_value, note)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (opportunity_id, field) WHERE status='pending' DO UPDATE
+		SET sync_id=EXCLUDED.sync_id, local_value=EXCLUDED.local_value,
+			changepoint_value=EXCLUDED.changepoint_value, note=EXCLUDED.note, created_at=now()`
+
+	_, err := tx.ExecContext(ctx, query, syncID, flag.OpportunityID, flag.Field, flag.LocalValue, flag.ChangepointValue, flag.Note)
+	return err
+}
+
+func insertProjectSyncEntry(ctx context.Context, tx *sql.Tx, entry *ProjectSyncEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO project_sync (sync_id, opportunity_id, changepoint_id, line, outcome, changes, note)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''))
+		RETURNING entry_id, created_at`
+
+	return tx.QueryRowContext(ctx, query, entry.SyncID, entry.OpportunityID, entry.ChangepointID, entry.Line,
+		entry.Outcome, string(changes), entry.Note).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+const projectSyncEntryColumns = `
+	entry_id, sync_id, COALESCE(opportunity_id, ''), COALESCE(changepoint_id, ''), line, outcome, changes,
+	COALESCE(note, ''), created_at`
+
+func scanProjectSyncEntry(scan func(...any) error, extra ...any) (*ProjectSyncEntry, error) {
+	var (
+		e       ProjectSyncEntry
+		changes []byte
+	)
+
+	dest := append(extra, &e.ID, &e.SyncID, &e.OpportunityID, &e.ChangepointID, &e.Line, &e.Outcome, &changes, &e.Note, &e.CreatedAt)
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(changes, &e.Changes); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+const projectSyncFlagColumns = `
+	flag_id, sync_id, opportunity_id, field, local_value, changepoint_value, COALESCE(note, ''), status,
+	created_at, resolved_at`
+
+func scanProjectSyncFlag(scan func(...any) error, extra ...any) (*ProjectSyncFlag, error) {
+	var f ProjectSyncFlag
+
+	dest := append(extra, &f.ID, &f.SyncID, &f.OpportunityID, &f.Field, &f.LocalValue, &f.ChangepointValue, &f.Note,
+		&f.Status, &f.CreatedAt, &f.ResolvedAt)
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// Get returns a sync with every entry it recorded.
+func (m *ChangepointModel) Get(id int64) (*ChangepointSync, error) {
+	query := `
+		SELECT sync_id, source, row_count, updated, unchanged, flagged, unmatched, created_at
+		FROM changepoint_sync
+		WHERE sync_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var s ChangepointSync
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&s.ID,
+		&s.Source,
+		&s.Rows,
+		&s.Updated,
+		&s.Unchanged,
+		&s.Flagged,
+		&s.Unmatched,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+projectSyncEntryColumns+`
+		FROM project_sync
+		WHERE sync_id=$1
+		ORDER BY entry_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s.Entries = []*ProjectSyncEntry{}
+
+	for rows.Next() {
+		e, err := scanProjectSyncEntry(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		s.Entries = append(s.Entries, e)
+	}
+
+	return &s, rows.Err()
+}
+
+// GetProjectHistory returns the entries recorded for a project, newest
+// first.
+func (m *ChangepointModel) GetProjectHistory(opportunityID string, filters Filters) ([]*ProjectSyncEntry, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), ` + projectSyncEntryColumns + `
+		FROM project_sync
+		WHERE opportunity_id=$1
+		ORDER BY entry_id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, opportunityID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*ProjectSyncEntry{}
+
+	for rows.Next() {
+		e, err := scanProjectSyncEntry(rows.Scan, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return entries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *ChangepointModel) GetFlag(id int64) (*ProjectSyncFlag, error) {
+	query := `
+		SELECT ` + projectSyncFlagColumns + `
+		FROM project_sync_flag
+		WHERE flag_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	flag, err := scanProjectSyncFlag(m.DB.QueryRowContext(ctx, query, id).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return flag, nil
+}
+
+// GetFlags returns flags with status, or all flags if status is empty, for
+// one project or, if opportunityID is empty, for every project.
+func (m *ChangepointModel) GetFlags(opportunityID, status string, filters Filters) ([]*ProjectSyncFlag, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+projectSyncFlagColumns+`
+		FROM project_sync_flag
+		WHERE (opportunity_id=$1 OR $1='')
+		AND (status=$2 OR $2='')
+		ORDER BY %s %s, flag_id
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, opportunityID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	flags := []*ProjectSyncFlag{}
+
+	for rows.Next() {
+		f, err := scanProjectSyncFlag(rows.Scan, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		flags = append(flags, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return flags, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// ResolveFlag accepts or rejects a pending flag. Accepting writes the
+// ChangePoint value to the project; for a changepoint id, the id is first
+// taken from any other project linked to it. Rejecting keeps the project as
+// it is, and the field is not flagged again until ChangePoint changes it.
+// ErrEditConflict is returned if the flag has already been resolved, and
+// ErrFlagNotApplicable if the value can still not be written.
+func (m *ChangepointModel) ResolveFlag(id int64, accept bool) (*ProjectSyncFlag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status := ProjectSyncFlagRejected
+	if accept {
+		status = ProjectSyncFlagAccepted
+	}
+
+	flag, err := scanProjectSyncFlag(tx.QueryRowContext(ctx, `
+		UPDATE project_sync_flag SET status=$2, resolved_at=now()
+		WHERE flag_id=$1 AND status='pending'
+		RETURNING `+projectSyncFlagColumns, id, status).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	if accept {
+		var value any = flag.ChangepointValue
+
+		switch flag.Field {
+		case "changepointId":
+			_, err = tx.ExecContext(ctx, `
+				UPDATE project SET changepoint_id=NULL
+				WHERE changepoint_id=$1 AND opportunity_id<>$2`, flag.ChangepointValue, flag.OpportunityID)
+			if err != nil {
+				return nil, err
+			}
+		case "status":
+			statuses, err := loadProjectStatuses(ctx, tx)
+			if err != nil {
+				return nil, err
+			}
+			if !validator.PermittedValue(flag.ChangepointValue, statuses...) {
+				return nil, fmt.Errorf("%w: %q is not a project status", ErrFlagNotApplicable, flag.ChangepointValue)
+			}
+		case "projectManager":
+			ids, err := loadResourceIDsByName(ctx, tx, []string{strings.ToLower(flag.ChangepointValue)})
+			if err != nil {
+				return nil, err
+			}
+			if n := len(ids[strings.ToLower(flag.ChangepointValue)]); n != 1 {
+				return nil, fmt.Errorf("%w: %d resources are named %q", ErrFlagNotApplicable, n, flag.ChangepointValue)
+			}
+			value = ids[strings.ToLower(flag.ChangepointValue)][0]
+		}
+
+		err = updateProjectFields(ctx, tx, flag.OpportunityID, map[string]any{flag.Field: value})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return flag, nil
+}
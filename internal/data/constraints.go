@@ -0,0 +1,143 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/lib/pq"
+)
+
+var ErrConstraintViolation = errors.New("constraint violation")
+
+// UnknownConstraintField is reported as the field of a constraint violation
+// that cannot be traced to a field of the API, so that database names are
+// never shown to clients.
+const UnknownConstraintField = "record"
+
+// ErrDuplicate reports that a unique value, such as an email address, is
+// already in use.
+type ErrDuplicate struct {
+	Field      string
+	Constraint string
+}
+
+func (e ErrDuplicate) Error() string {
+	return fmt.Sprintf("duplicate value for %s", e.Field)
+}
+
+func (e ErrDuplicate) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// ErrForeignKey reports a reference to a record that does not exist, or a
+// delete of a record that is still referenced.
+type ErrForeignKey struct {
+	Field      string
+	Constraint string
+}
+
+func (e ErrForeignKey) Error() string {
+	return fmt.Sprintf("invalid reference for %s", e.Field)
+}
+
+func (e ErrForeignKey) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// ErrInvalidValue reports a value rejected by a check, not-null or enum
+// constraint.
+type ErrInvalidValue struct {
+	Field      string
+	Constraint string
+}
+
+func (e ErrInvalidValue) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.Field)
+}
+
+func (e ErrInvalidValue) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+var constraintFields = map[string]string{
+	"resource_pkey":                                "id",
+	"resource_email_key":                           "email",
+	"resource_job_title_id_fkey":                   "jobTitle",
+	"resource_manager_id_fkey":                     "manager",
+	"resource_workgroup_id_fkey":                   "workgroup",
+	"project_pkey":                                 "opportunityId",
+	"project_changepoint_id_key":                   "changepointId",
+	"project_status_id_fkey":                       "status",
+	"resource_request_opportunity_id_fkey":         "opportunityId",
+	"resource_request_job_title_id_fkey":           "jobTitle",
+	"resource_request_comment_request_id_fkey":     "requestId",
+	"resource_assignment_employee_id_fkey":         "resource",
+	"resource_assignment_resource_request_id_fkey": "requestId",
+}
+
+var columnFields = map[string]string{
+	"employee_id":        "id",
+	"job_title_id":       "jobTitle",
+	"manager_id":         "manager",
+	"workgroup_id":       "workgroup",
+	"opportunity_id":     "opportunityId",
+	"changepoint_id":     "changepointId",
+	"revenue_type":       "revenueType",
+	"end_customer":       "endCustomer",
+	"project_manager_id": "projectManager",
+	"status_id":          "status",
+	"request_id":         "requestId",
+}
+
+var enumFields = map[string]string{
+	"clearance":    "clearance",
+	"revenue_type": "revenueType",
+}
+
+var rxEnumType = regexp.MustCompile(`invalid input value for enum (\w+)`)
+
+// constraintError translates Postgres integrity errors into the typed errors
+// above, keeping the database's name for the constraint for logging. Any
+// other error is returned unchanged.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	constraint := pqErr.Constraint
+	if constraint == "" {
+		constraint = pqErr.Column
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return ErrDuplicate{Field: constraintField(pqErr), Constraint: constraint}
+	case "foreign_key_violation":
+		return ErrForeignKey{Field: constraintField(pqErr), Constraint: constraint}
+	case "check_violation", "not_null_violation":
+		return ErrInvalidValue{Field: constraintField(pqErr), Constraint: constraint}
+	case "invalid_text_representation":
+		if m := rxEnumType.FindStringSubmatch(pqErr.Message); m != nil {
+			if field, ok := enumFields[m[1]]; ok {
+				return ErrInvalidValue{Field: field, Constraint: m[1]}
+			}
+			return ErrInvalidValue{Field: UnknownConstraintField, Constraint: m[1]}
+		}
+	}
+
+	return err
+}
+
+// constraintField maps the constraint or column behind an error to the API
+// field it guards, or UnknownConstraintField if it is not mapped.
+func constraintField(pqErr *pq.Error) string {
+	if field, ok := constraintFields[pqErr.Constraint]; ok {
+		return field
+	}
+	if field, ok := columnFields[pqErr.Column]; ok {
+		return field
+	}
+	return UnknownConstraintField
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor identifies a row in a sorted result set by the value of its sort
+// column and its primary key, so the next page can be fetched by keyset.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"k"`
+}
+
+// Encode returns the cursor as an opaque token signed with key.
+func (c Cursor) Encode(key []byte) string {
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode, rejecting any token
+// whose signature does not match key.
+func DecodeCursor(token string, key []byte) (*Cursor, error) {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
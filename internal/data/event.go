@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// EventStreamEntities are the kinds of change pushed to live dashboards.
+var EventStreamEntities = []string{"project", "request", "comment", "assignment"}
+
+// ChangeEvent is an entry in the change log that feeds webhooks, annotated
+// with the project it belongs to and the workgroups staffed on that project
+// so that stream clients can filter it.
+type ChangeEvent struct {
+	ID            int64           `json:"id"`
+	TxID          uint64          `json:"-"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"data"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	OpportunityID string          `json:"opportunityId,omitempty"`
+	Workgroups    []int64         `json:"workgroups,omitempty"`
+}
+
+func (e *ChangeEvent) Cursor() EventCursor {
+	return EventCursor{TxID: e.TxID, ID: e.ID}
+}
+
+// EventCursor is a position in the change log. Event IDs are taken before
+// the transaction that records the event commits, so a lower ID can become
+// visible after a higher one. The log is read in the order of the recording
+// transaction's ID instead, and only up to the oldest transaction still in
+// progress, so nothing can later appear behind a cursor.
+type EventCursor struct {
+	TxID uint64
+	ID   int64
+}
+
+// Before reports whether c is earlier in the change log than o.
+func (c EventCursor) Before(o EventCursor) bool {
+	return c.TxID < o.TxID || c.TxID == o.TxID && c.ID < o.ID
+}
+
+type EventModel struct {
+	DB *sql.DB
+}
+
+// Latest returns the cursor of the most recent change event that can be
+// read.
+func (m *EventModel) Latest() (EventCursor, error) {
+	query := `
+		SELECT txid, event_id
+		FROM webhook_event
+		WHERE txid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY txid DESC, event_id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var c EventCursor
+	err := m.DB.QueryRowContext(ctx, query).Scan(&c.TxID, &c.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, nil
+	}
+	return c, err
+}
+
+// CursorFor returns the cursor of the event with the given ID, for clients
+// that resume from an event ID. If the event has since been cleaned up, the
+// cursor is placed just before the next event after it.
+func (m *EventModel) CursorFor(id int64) (EventCursor, error) {
+	query := `
+		SELECT COALESCE(
+			(SELECT txid FROM webhook_event WHERE event_id=$1),
+			(SELECT min(txid) FROM webhook_event WHERE event_id > $1),
+			pg_snapshot_xmin(pg_current_snapshot()))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := EventCursor{ID: id}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&c.TxID)
+	return c, err
+}
+
+// GetSince returns up to limit stream events after the cursor, in change
+// log order. An event's workgroups are those of the consultant for
+// assignment events, and of everyone assigned to the project otherwise.
+func (m *EventModel) GetSince(after EventCursor, limit int) ([]*ChangeEvent, error) {
+	query := `
+		SELECT e.event_id, e.txid, e.event_type, e.payload, e.created_at, COALESCE(p.opportunity_id, ''), COALESCE(w.workgroups, '{}')
+		FROM webhook_event e
+			LEFT JOIN LATERAL (
+				SELECT COALESCE(e.payload->>'opportunity_id', rr.opportunity_id) AS opportunity_id
+				FROM (SELECT 1) one
+					LEFT JOIN resource_request rr
+					ON rr.request_id=COALESCE(e.payload->>'request_id', e.payload->>'resource_request_id')::bigint
+			) p ON true
+			LEFT JOIN LATERAL (
+				SELECT array_agg(DISTINCT r.workgroup_id) AS workgroups
+				FROM resource r
+				WHERE (e.event_type LIKE 'assignment.%' AND r.employee_id=(e.payload->>'employee_id')::int)
+				OR r.employee_id IN (
+					SELECT a.employee_id
+					FROM resource_assignment a
+						INNER JOIN resource_request rr ON rr.request_id=a.resource_request_id
+					WHERE rr.opportunity_id=p.opportunity_id)
+			) w ON true
+		WHERE (e.txid, e.event_id) > ($1::xid8, $2)
+		AND e.txid < pg_snapshot_xmin(pg_current_snapshot())
+		AND split_part(e.event_type, '.', 1) = ANY($3)
+		ORDER BY e.txid, e.event_id
+		LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, strconv.FormatUint(after.TxID, 10), after.ID, pq.Array(EventStreamEntities), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*ChangeEvent{}
+
+	for rows.Next() {
+		var e ChangeEvent
+		err := rows.Scan(
+			&e.ID,
+			&e.TxID,
+			&e.Type,
+			&e.Payload,
+			&e.CreatedAt,
+			&e.OpportunityID,
+			pq.Array(&e.Workgroups),
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,478 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+type FieldKind int
+
+const (
+	FieldText FieldKind = iota
+	FieldNumber
+	FieldBool
+	FieldEnum
+	FieldArray
+)
+
+// FilterField maps a field name usable in a filter expression onto the SQL
+// expression it is compared against.
+type FilterField struct {
+	Column string
+	Kind   FieldKind
+	Values []string
+}
+
+type FilterFields map[string]FilterField
+
+var ResourceFilterFields = FilterFields{
+	"id":             {Column: "r.employee_id", Kind: FieldNumber},
+	"name":           {Column: "r.name", Kind: FieldText},
+	"email":          {Column: "r.email", Kind: FieldText},
+	"jobTitle":       {Column: "job_title.title", Kind: FieldText},
+	"manager":        {Column: "m.name", Kind: FieldText},
+	"workgroup":      {Column: "workgroup.workgroup_name", Kind: FieldText},
+	"clearance":      {Column: "r.clearance::text", Kind: FieldEnum, Values: []string{"None", "Baseline", "NV1", "NV2", "TSPV"}},
+	"specialties":    {Column: "r.specialties", Kind: FieldArray},
+	"certifications": {Column: "r.certifications", Kind: FieldArray},
+	"active":         {Column: "r.active", Kind: FieldBool},
+}
+
+var ProjectFilterFields = FilterFields{
+	"opportunityId":  {Column: "p.opportunity_id", Kind: FieldText},
+	"changepointId":  {Column: "p.changepoint_id", Kind: FieldText},
+	"name":           {Column: "p.name", Kind: FieldText},
+	"revenueType":    {Column: "p.revenue_type::text", Kind: FieldEnum, Values: []string{"Fixed Fee", "T&M"}},
+	"customer":       {Column: "p.customer", Kind: FieldText},
+	"endCustomer":    {Column: "COALESCE(p.end_customer, '')", Kind: FieldText},
+	"projectManager": {Column: "r.name", Kind: FieldText},
+	"status":         {Column: "ps.status", Kind: FieldText},
+}
+
+// Filter expressions come from query strings, so their size is capped to
+// bound the work of parsing them and the depth of the parser's recursion.
+const (
+	filterMaxLength = 1024
+	filterMaxDepth  = 16
+)
+
+// FilterExpr is a parsed filter expression such as
+//
+//	clearance in (NV1, NV2) and specialties has "vSAN" and name ~ "smi"
+//
+// Supported operators are =, !=, <, <=, >, >=, ~ (contains, case-insensitive),
+// ^= (prefix, case-insensitive), in (...) and has (array contains), combined
+// with and, or and parentheses.
+type FilterExpr struct {
+	root filterNode
+}
+
+type filterNode interface {
+	sql(args *[]any) string
+}
+
+type filterLogical struct {
+	op          string
+	left, right filterNode
+}
+
+func (n filterLogical) sql(args *[]any) string {
+	return fmt.Sprintf("(%s %s %s)", n.left.sql(args), n.op, n.right.sql(args))
+}
+
+type filterComparison struct {
+	field FilterField
+	op    string
+	value any
+}
+
+func (n filterComparison) sql(args *[]any) string {
+	*args = append(*args, n.value)
+	placeholder := fmt.Sprintf("$%d", len(*args))
+
+	switch n.op {
+	case "~", "^=":
+		return fmt.Sprintf("%s ILIKE %s", n.field.Column, placeholder)
+	case "in":
+		if n.field.Kind == FieldArray {
+			return fmt.Sprintf("%s && %s", n.field.Column, placeholder)
+		}
+		return fmt.Sprintf("%s = ANY(%s)", n.field.Column, placeholder)
+	case "has":
+		return fmt.Sprintf("%s @> %s", n.field.Column, placeholder)
+	default:
+		return fmt.Sprintf("%s %s %s", n.field.Column, n.op, placeholder)
+	}
+}
+
+// where renders the expression as an AND clause, appending its parameters to
+// args so placeholders continue from the caller's own parameters.
+func (e *FilterExpr) where(args *[]any) string {
+	if e == nil || e.root == nil {
+		return ""
+	}
+	return "AND " + e.root.sql(args)
+}
+
+// ParseFilter parses expr against the permitted fields. Problems are recorded
+// on v keyed by the offending token's offset, e.g. "filter[12]".
+func ParseFilter(v *validator.Validator, expr string, fields FilterFields) *FilterExpr {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+
+	if len(expr) > filterMaxLength {
+		v.AddErrorCode("filter", validator.CodeTooLong, fmt.Sprintf("cannot be more than %d bytes", filterMaxLength))
+		return nil
+	}
+
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		v.AddError(fmt.Sprintf("filter[%d]", err.pos), err.message)
+		return nil
+	}
+
+	p := &filterParser{tokens: tokens, fields: fields, v: v}
+
+	root := p.parseOr()
+	if p.failed {
+		return nil
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		p.errorAt(tok, fmt.Sprintf("unexpected %q", tok.text))
+	}
+
+	if p.invalid {
+		return nil
+	}
+
+	return &FilterExpr{root: root}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type filterSyntaxError struct {
+	pos     int
+	message string
+}
+
+func lexFilter(expr string) ([]filterToken, *filterSyntaxError) {
+	var tokens []filterToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{tokenRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, filterToken{tokenComma, ",", i})
+			i++
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &filterSyntaxError{start, "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, filterToken{tokenString, sb.String(), start})
+		case strings.ContainsRune("=!<>~^", c):
+			start := i
+			op := string(c)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if !validator.PermittedValue(op, "=", "!=", "<", "<=", ">", ">=", "~", "^=") {
+				return nil, &filterSyntaxError{start, fmt.Sprintf("unknown operator %q", op)}
+			}
+			i += len(op)
+			tokens = append(tokens, filterToken{tokenOp, op, start})
+		case isFilterWordRune(c):
+			start := i
+			for i < len(runes) && isFilterWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenWord, string(runes[start:i]), start})
+		default:
+			return nil, &filterSyntaxError{i, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+
+	return append(tokens, filterToken{tokenEOF, "", len(runes)}), nil
+}
+
+func isFilterWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_-.@&", c)
+}
+
+type filterParser struct {
+	tokens  []filterToken
+	pos     int
+	depth   int
+	fields  FilterFields
+	v       *validator.Validator
+	failed  bool
+	invalid bool
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) keyword(tok filterToken, word string) bool {
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, word)
+}
+
+func (p *filterParser) errorAt(tok filterToken, message string) {
+	p.v.AddError(fmt.Sprintf("filter[%d]", tok.pos), message)
+	p.invalid = true
+}
+
+func (p *filterParser) syntaxError(tok filterToken, message string) {
+	p.errorAt(tok, message)
+	p.failed = true
+}
+
+func (p *filterParser) parseOr() filterNode {
+	left := p.parseAnd()
+	for !p.failed && p.keyword(p.peek(), "or") {
+		p.next()
+		right := p.parseAnd()
+		left = filterLogical{op: "OR", left: left, right: right}
+	}
+	return left
+}
+
+func (p *filterParser) parseAnd() filterNode {
+	left := p.parseFactor()
+	for !p.failed && p.keyword(p.peek(), "and") {
+		p.next()
+		right := p.parseFactor()
+		left = filterLogical{op: "AND", left: left, right: right}
+	}
+	return left
+}
+
+func (p *filterParser) parseFactor() filterNode {
+	if p.failed {
+		return nil
+	}
+
+	if tok := p.peek(); tok.kind == tokenLParen {
+		if p.depth == filterMaxDepth {
+			p.syntaxError(tok, fmt.Sprintf("cannot nest parentheses more than %d deep", filterMaxDepth))
+			return nil
+		}
+
+		p.next()
+		p.depth++
+		node := p.parseOr()
+		p.depth--
+		if p.failed {
+			return nil
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			p.syntaxError(tok, "expected ')'")
+			return nil
+		}
+		return node
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() filterNode {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenWord {
+		p.syntaxError(fieldTok, "expected a field name")
+		return nil
+	}
+
+	field, known := p.fields[fieldTok.text]
+	if !known {
+		p.errorAt(fieldTok, fmt.Sprintf("%q is not a filterable field", fieldTok.text))
+	}
+
+	opTok := p.next()
+	var op string
+	switch {
+	case opTok.kind == tokenOp:
+		op = opTok.text
+	case p.keyword(opTok, "in"), p.keyword(opTok, "has"):
+		op = strings.ToLower(opTok.text)
+	default:
+		p.syntaxError(opTok, "expected an operator")
+		return nil
+	}
+
+	var values []filterToken
+	if op == "in" {
+		values = p.parseList()
+	} else {
+		values = p.parseValue()
+	}
+	if p.failed {
+		return nil
+	}
+
+	if !known {
+		return filterComparison{}
+	}
+
+	if !operatorAllowed(field.Kind, op) {
+		p.errorAt(opTok, fmt.Sprintf("operator %q cannot be used with %q", op, fieldTok.text))
+		return filterComparison{}
+	}
+
+	value, ok := p.convert(field, op, values)
+	if !ok {
+		return filterComparison{}
+	}
+
+	return filterComparison{field: field, op: op, value: value}
+}
+
+func (p *filterParser) parseList() []filterToken {
+	if tok := p.next(); tok.kind != tokenLParen {
+		p.syntaxError(tok, "expected '('")
+		return nil
+	}
+
+	var values []filterToken
+	for {
+		values = append(values, p.parseValue()...)
+		if p.failed {
+			return nil
+		}
+
+		tok := p.next()
+		if tok.kind == tokenRParen {
+			return values
+		}
+		if tok.kind != tokenComma {
+			p.syntaxError(tok, "expected ',' or ')'")
+			return nil
+		}
+	}
+}
+
+func (p *filterParser) parseValue() []filterToken {
+	tok := p.next()
+	if tok.kind != tokenWord && tok.kind != tokenString {
+		p.syntaxError(tok, "expected a value")
+		return nil
+	}
+	return []filterToken{tok}
+}
+
+func operatorAllowed(kind FieldKind, op string) bool {
+	switch kind {
+	case FieldText:
+		return op != "has"
+	case FieldNumber:
+		return validator.PermittedValue(op, "=", "!=", "<", "<=", ">", ">=", "in")
+	case FieldBool:
+		return validator.PermittedValue(op, "=", "!=")
+	case FieldEnum:
+		return validator.PermittedValue(op, "=", "!=", "in")
+	case FieldArray:
+		return validator.PermittedValue(op, "has", "in")
+	}
+	return false
+}
+
+func (p *filterParser) convert(field FilterField, op string, values []filterToken) (any, bool) {
+	ok := true
+
+	switch field.Kind {
+	case FieldNumber:
+		nums := make([]int64, len(values))
+		for i, tok := range values {
+			n, err := strconv.ParseInt(tok.text, 10, 64)
+			if err != nil {
+				p.errorAt(tok, fmt.Sprintf("%q must be an integer", tok.text))
+				ok = false
+			}
+			nums[i] = n
+		}
+		if op == "in" {
+			return pq.Array(nums), ok
+		}
+		return nums[0], ok
+	case FieldBool:
+		b, err := strconv.ParseBool(values[0].text)
+		if err != nil {
+			p.errorAt(values[0], "must be 'true' or 'false'")
+			return nil, false
+		}
+		return b, true
+	}
+
+	strs := make([]string, len(values))
+	for i, tok := range values {
+		strs[i] = tok.text
+		if field.Kind == FieldEnum && !validator.PermittedValue(tok.text, field.Values...) {
+			p.errorAt(tok, fmt.Sprintf("%q must be one of %s", tok.text, strings.Join(field.Values, ", ")))
+			ok = false
+		}
+	}
+
+	switch {
+	case op == "in" || op == "has":
+		return pq.Array(strs), ok
+	case op == "~":
+		return "%" + escapeLike(strs[0]) + "%", ok
+	case op == "^=":
+		return escapeLike(strs[0]) + "%", ok
+	default:
+		return strs[0], ok
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
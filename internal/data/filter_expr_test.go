@@ -0,0 +1,124 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+func TestParseFilterValid(t *testing.T) {
+	tests := []struct {
+		expr  string
+		where string
+		args  []any
+	}{
+		{``, ``, nil},
+		{`   `, ``, nil},
+		{`name = "Jo Smith"`, `AND r.name = $1`, []any{"Jo Smith"}},
+		{`name ~ smi`, `AND r.name ILIKE $1`, []any{"%smi%"}},
+		{`name ^= "50%_off"`, `AND r.name ILIKE $1`, []any{`50\%\_off%`}},
+		{`id >= 100`, `AND r.employee_id >= $1`, []any{int64(100)}},
+		{`id in (1, 2,3)`, `AND r.employee_id = ANY($1)`, []any{pq.Array([]int64{1, 2, 3})}},
+		{`active = true`, `AND r.active = $1`, []any{true}},
+		{`clearance in (NV1, NV2)`, `AND r.clearance::text = ANY($1)`, []any{pq.Array([]string{"NV1", "NV2"})}},
+		{`specialties has "vSAN"`, `AND r.specialties @> $1`, []any{pq.Array([]string{"vSAN"})}},
+		{`certifications in (VCP, VCAP)`, `AND r.certifications && $1`, []any{pq.Array([]string{"VCP", "VCAP"})}},
+		{
+			`id = 1 or id = 2 and active = false`,
+			`AND (r.employee_id = $1 OR (r.employee_id = $2 AND r.active = $3))`,
+			[]any{int64(1), int64(2), false},
+		},
+		{
+			`(id = 1 OR id = 2) AND active != true`,
+			`AND ((r.employee_id = $1 OR r.employee_id = $2) AND r.active != $3)`,
+			[]any{int64(1), int64(2), true},
+		},
+		{
+			strings.Repeat("(", filterMaxDepth) + `id = 1` + strings.Repeat(")", filterMaxDepth),
+			`AND r.employee_id = $1`,
+			[]any{int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+
+		expr := ParseFilter(v, tt.expr, ResourceFilterFields)
+		if !v.Valid() {
+			t.Errorf("ParseFilter(%q) returned errors: %v", tt.expr, v.Map())
+			continue
+		}
+
+		var args []any
+		if where := expr.where(&args); where != tt.where {
+			t.Errorf("ParseFilter(%q) = %q, want %q", tt.expr, where, tt.where)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("ParseFilter(%q) args = %#v, want %#v", tt.expr, args, tt.args)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []struct {
+		expr   string
+		errors map[string]string
+	}{
+		{`name`, map[string]string{"filter[4]": "expected an operator"}},
+		{`= 1`, map[string]string{"filter[0]": "expected a field name"}},
+		{`name =`, map[string]string{"filter[6]": "expected a value"}},
+		{`name = "Jo`, map[string]string{"filter[7]": "unterminated string"}},
+		{`name == x`, map[string]string{"filter[5]": `unknown operator "=="`}},
+		{`name <> x`, map[string]string{"filter[6]": "expected a value"}},
+		{`name ! x`, map[string]string{"filter[5]": `unknown operator "!"`}},
+		{`name = x;`, map[string]string{"filter[8]": `unexpected character ';'`}},
+		{`name = x y`, map[string]string{"filter[9]": `unexpected "y"`}},
+		{`(name = x`, map[string]string{"filter[9]": "expected ')'"}},
+		{`name = x)`, map[string]string{"filter[8]": `unexpected ")"`}},
+		{`id in 1`, map[string]string{"filter[6]": "expected '('"}},
+		{`id in (1 2)`, map[string]string{"filter[9]": "expected ',' or ')'"}},
+		{`id in (1,`, map[string]string{"filter[9]": "expected a value"}},
+		{`name = x and`, map[string]string{"filter[12]": "expected a field name"}},
+		{`salary > 1`, map[string]string{"filter[0]": `"salary" is not a filterable field`}},
+		{`id = abc`, map[string]string{"filter[5]": `"abc" must be an integer`}},
+		{`id in (1, x, 3)`, map[string]string{"filter[10]": `"x" must be an integer`}},
+		{`active = maybe`, map[string]string{"filter[9]": "must be 'true' or 'false'"}},
+		{`clearance = Secret`, map[string]string{"filter[12]": `"Secret" must be one of None, Baseline, NV1, NV2, TSPV`}},
+		{`specialties = vSAN`, map[string]string{"filter[12]": `operator "=" cannot be used with "specialties"`}},
+		{`name has x`, map[string]string{"filter[5]": `operator "has" cannot be used with "name"`}},
+		{
+			`salary > 1 and id = x`,
+			map[string]string{
+				"filter[0]":  `"salary" is not a filterable field`,
+				"filter[20]": `"x" must be an integer`,
+			},
+		},
+		{
+			strings.Repeat("(", filterMaxDepth+1) + `id = 1` + strings.Repeat(")", filterMaxDepth+1),
+			map[string]string{"filter[16]": "cannot nest parentheses more than 16 deep"},
+		},
+		{
+			strings.Repeat("(", 100000),
+			map[string]string{"filter": "cannot be more than 1024 bytes"},
+		},
+		{
+			`name = "` + strings.Repeat("x", filterMaxLength) + `"`,
+			map[string]string{"filter": "cannot be more than 1024 bytes"},
+		},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+
+		expr := ParseFilter(v, tt.expr, ResourceFilterFields)
+		if expr != nil {
+			t.Errorf("ParseFilter(%.40q) returned an expression", tt.expr)
+		}
+		if got := v.Map(); !reflect.DeepEqual(got, tt.errors) {
+			t.Errorf("ParseFilter(%.40q) errors = %v, want %v", tt.expr, got, tt.errors)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"fmt"
 	"math"
 	"strings"
 
@@ -12,22 +13,34 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	After        *Cursor
+	Before       *Cursor
+	SkipCount    bool
+	Expr         *FilterExpr
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"currentPage,omitempty"`
-	PageSize     int `json:"pageSize,omitempty"`
-	FirstPage    int `json:"firstPage,omitempty"`
-	LastPage     int `json:"lastPage,omitempty"`
-	TotalRecords int `json:"totalRecords,omitempty"`
+	CurrentPage  int     `json:"currentPage,omitempty"`
+	PageSize     int     `json:"pageSize,omitempty"`
+	FirstPage    int     `json:"firstPage,omitempty"`
+	LastPage     int     `json:"lastPage,omitempty"`
+	TotalRecords int     `json:"totalRecords,omitempty"`
+	Next         string  `json:"next,omitempty"`
+	Prev         string  `json:"prev,omitempty"`
+	NextCursor   *Cursor `json:"-"`
+	PrevCursor   *Cursor `json:"-"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be a positive integer")
-	v.Check(f.Page <= 10000000, "page", "must be less than 10 million")
-	v.Check(f.PageSize > 0, "pageSize", "must be a positive integer")
-	v.Check(f.PageSize <= 100, "pageSize", "must be a maximum of 100")
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.CheckCode(f.Page > 0, "page", validator.CodeOutOfRange, "must be a positive integer")
+	v.CheckCode(f.Page <= 10000000, "page", validator.CodeOutOfRange, "must be less than 10 million")
+	v.CheckCode(f.PageSize > 0, "pageSize", validator.CodeOutOfRange, "must be a positive integer")
+	v.CheckCode(f.PageSize <= 100, "pageSize", validator.CodeOutOfRange, "must be a maximum of 100")
+	v.CheckCode(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", validator.CodeNotPermitted, "invalid sort value")
+	v.Check(f.After == nil || f.Before == nil, "before", "cannot be used together with after")
+	v.Check(!f.keyset() || f.Page == 1, "page", "cannot be used together with after or before")
+	v.Check(f.After == nil || f.After.Sort == f.Sort, "after", "does not match the sort value")
+	v.Check(f.Before == nil || f.Before.Sort == f.Sort, "before", "does not match the sort value")
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -65,5 +78,90 @@ func (f Filters) limit() int {
 }
 
 func (f Filters) offset() int {
+	if f.keyset() {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
+
+func (f Filters) keyset() bool {
+	return f.After != nil || f.Before != nil
+}
+
+// orderBy returns the ORDER BY expression for the sort column and primary key.
+// When paging backwards the order is reversed; keysetPage restores it.
+func (f Filters) orderBy(sortExpr, idExpr string) string {
+	direction := f.sortDirection()
+	if f.Before != nil {
+		if direction == "ASC" {
+			direction = "DESC"
+		} else {
+			direction = "ASC"
+		}
+	}
+	return fmt.Sprintf("%s %s, %s %s", sortExpr, direction, idExpr, direction)
+}
+
+// keysetCondition returns the WHERE clause fragment, starting at placeholder
+// $argPos, which restricts results to rows after (or before) the cursor.
+func (f Filters) keysetCondition(sortExpr, idExpr string, argPos int) (string, []any) {
+	cursor := f.After
+	if cursor == nil {
+		cursor = f.Before
+	}
+	if cursor == nil {
+		return "", nil
+	}
+
+	op := ">"
+	if (f.sortDirection() == "DESC") != (f.Before != nil) {
+		op = "<"
+	}
+
+	clause := fmt.Sprintf("AND (%s, %s) %s ($%d, $%d)", sortExpr, idExpr, op, argPos, argPos+1)
+	return clause, []any{cursor.Value, cursor.ID}
+}
+
+// keysetPage trims the extra row fetched to detect further pages, restores the
+// requested order and fills in the cursors for the neighbouring pages.
+func keysetPage[T any](f Filters, records []T, totalRecords int, cursorFor func(T) (string, string)) ([]T, Metadata) {
+	hasMore := len(records) > f.limit()
+	if hasMore {
+		records = records[:f.limit()]
+	}
+
+	if f.Before != nil {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	var metadata Metadata
+	switch {
+	case f.keyset():
+		metadata = Metadata{PageSize: f.PageSize, TotalRecords: totalRecords}
+	case f.SkipCount:
+		metadata = Metadata{CurrentPage: f.Page, PageSize: f.PageSize, FirstPage: 1}
+	default:
+		metadata = calculateMetadata(totalRecords, f.Page, f.PageSize)
+	}
+
+	if len(records) == 0 {
+		return records, metadata
+	}
+
+	cursor := func(record T) *Cursor {
+		value, id := cursorFor(record)
+		return &Cursor{Sort: f.Sort, Value: value, ID: id}
+	}
+
+	if f.Before != nil || hasMore {
+		metadata.NextCursor = cursor(records[len(records)-1])
+	}
+
+	if f.After != nil || (f.Before != nil && hasMore) || (!f.keyset() && f.Page > 1) {
+		metadata.PrevCursor = cursor(records[0])
+	}
+
+	return records, metadata
+}
@@ -0,0 +1,403 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+var JobStatuses = []string{JobQueued, JobRunning, JobSucceeded, JobDead}
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LockedBy    string          `json:"lockedBy,omitempty"`
+	LastError   string          `json:"lastError,omitempty"`
+	UniqueKey   string          `json:"uniqueKey,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+func ValidateJobStatus(v *validator.Validator, status string) {
+	if status != "" {
+		v.CheckCode(validator.PermittedValue(status, JobStatuses...), "status", validator.CodeNotPermitted, "invalid status value")
+	}
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so that jobs can be
+// enqueued in the same transaction as the change that caused them.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Insert queues job. If a job with the same UniqueKey already exists the
+// insert is skipped and the job's ID is left as zero.
+func (m *JobModel) Insert(job *Job) error {
+	return m.insert(m.DB, job)
+}
+
+// InsertTx queues job as part of tx.
+func (m *JobModel) InsertTx(tx *sql.Tx, job *Job) error {
+	return m.insert(tx, job)
+}
+
+func (m *JobModel) insert(q querier, job *Job) error {
+	query := `
+		INSERT INTO job (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING job_id, status, created_at, updated_at`
+
+	if job.Payload == nil {
+		job.Payload = json.RawMessage("{}")
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = 5
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+
+	args := []any{job.Kind, string(job.Payload), job.MaxAttempts, job.RunAt, job.UniqueKey}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.Status, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// Claim locks the next job that is due, marks it running and returns it.
+// Concurrent workers skip each other's locked rows, so a job is only ever
+// claimed once. It returns ErrNotFound when no job is due.
+func (m *JobModel) Claim(worker string) (*Job, error) {
+	query := `
+		UPDATE job
+		SET status='running', attempts=attempts+1, locked_at=now(), locked_by=$1, updated_at=now()
+		WHERE job_id = (
+			SELECT job_id FROM job
+			WHERE status='queued' AND run_at <= now()
+			ORDER BY run_at, job_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING job_id, kind, payload, status, attempts, max_attempts, run_at, locked_by,
+			COALESCE(last_error, ''), COALESCE(unique_key, ''), created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := scanJob(m.DB.QueryRowContext(ctx, query, worker))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// Complete marks a job the worker holds as succeeded. If the job has been
+// released by the reaper in the meantime, it is left alone and
+// ErrEditConflict is returned.
+func (m *JobModel) Complete(id int64, worker string) error {
+	query := `
+		UPDATE job
+		SET status='succeeded', locked_at=NULL, locked_by=NULL, last_error=NULL, updated_at=now()
+		WHERE job_id=$1 AND status='running' AND locked_by=$2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, worker)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt at a job the worker holds. The job is
+// queued again at retryAt, or moved to the dead letter state if it has no
+// attempts left. If the job has been released by the reaper in the
+// meantime, it is left alone and ErrEditConflict is returned.
+func (m *JobModel) Fail(id int64, worker string, jobErr error, retryAt time.Time) (dead bool, err error) {
+	query := `
+		UPDATE job
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead'::job_status ELSE 'queued'::job_status END,
+			run_at = $3, last_error = $4, locked_at=NULL, locked_by=NULL, updated_at=now()
+		WHERE job_id=$1 AND status='running' AND locked_by=$2
+		RETURNING status='dead'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, id, worker, retryAt, jobErr.Error()).Scan(&dead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrEditConflict
+	}
+	return dead, err
+}
+
+// Release queues a job the worker holds to run again immediately without
+// counting the attempt, for jobs interrupted by shutdown rather than
+// failing on their own.
+func (m *JobModel) Release(id int64, worker string) error {
+	query := `
+		UPDATE job
+		SET status='queued', attempts=greatest(attempts-1, 0), run_at=now(),
+			locked_at=NULL, locked_by=NULL, updated_at=now()
+		WHERE job_id=$1 AND status='running' AND locked_by=$2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, worker)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Retry queues a dead or waiting job to run immediately with a fresh set of
+// attempts. Jobs that are running or have succeeded are left alone and
+// ErrEditConflict is returned.
+func (m *JobModel) Retry(id int64) (*Job, error) {
+	query := `
+		UPDATE job
+		SET status='queued', attempts=0, run_at=now(), updated_at=now()
+		WHERE job_id=$1 AND status IN ('queued', 'dead')
+		RETURNING job_id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(locked_by, ''),
+			COALESCE(last_error, ''), COALESCE(unique_key, ''), created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := scanJob(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if _, err := m.Get(id); err != nil {
+				return nil, err
+			}
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// RequeueStale releases jobs whose worker has held them for longer than
+// timeout, which happens when a process dies mid-job.
+func (m *JobModel) RequeueStale(timeout time.Duration) (int64, error) {
+	query := `
+		UPDATE job
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead'::job_status ELSE 'queued'::job_status END,
+			last_error = 'worker ' || COALESCE(locked_by, '') || ' timed out',
+			locked_at=NULL, locked_by=NULL, updated_at=now()
+		WHERE status='running' AND locked_at < now() - make_interval(secs => $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, timeout.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteSucceeded removes succeeded jobs last updated before cutoff.
+func (m *JobModel) DeleteSucceeded(cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM job
+		WHERE status='succeeded' AND updated_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (m *JobModel) Get(id int64) (*Job, error) {
+	query := `
+		SELECT job_id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(locked_by, ''),
+			COALESCE(last_error, ''), COALESCE(unique_key, ''), created_at, updated_at
+		FROM job
+		WHERE job_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := scanJob(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+func (m *JobModel) GetAll(status, kind string, filters Filters) ([]*Job, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), job_id, kind, payload, status, attempts, max_attempts, run_at, COALESCE(locked_by, ''),
+			COALESCE(last_error, ''), COALESCE(unique_key, ''), created_at, updated_at
+		FROM job
+		WHERE (status::text=$1 OR $1='')
+		AND (kind=$2 OR $2='')
+		ORDER BY %s %s, job_id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	jobs := []*Job{}
+
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&totalRecords,
+			&job.ID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LockedBy,
+			&job.LastError,
+			&job.UniqueKey,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return jobs, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// CountByStatus returns the number of jobs in each status.
+func (m *JobModel) CountByStatus() (map[string]int, error) {
+	query := `
+		SELECT status, count(*)
+		FROM job
+		GROUP BY status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(JobStatuses))
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+
+	return counts, rows.Err()
+}
+
+func scanJob(row *sql.Row) (*Job, error) {
+	var job Job
+
+	err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LockedBy,
+		&job.LastError,
+		&job.UniqueKey,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
@@ -3,6 +3,8 @@ package data
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/vmw-pso/back-end/internal/validator"
 )
 
 var (
@@ -16,14 +18,39 @@ type Models struct {
 	ResourceRequests        ResourceRequestModel
 	ResourceRequestComments ResourceRequestCommentModel
 	ResourceAssignments     ResourceAssignmentModel
+	ResourceCertifications  ResourceCertificationModel
+	Search                  SearchModel
+	References              ReferenceModel
+	System                  SystemModel
+	Jobs                    JobModel
+	Notifications           NotificationModel
+	Webhooks                WebhookModel
+	Events                  EventModel
+	Roster                  RosterModel
+	Changepoint             ChangepointModel
+	ReferenceData           *ReferenceCache
 }
 
 func NewModels(db *sql.DB) *Models {
+	cache := &ReferenceCache{DB: db}
+	validator.RegisterEnum("projectStatus", cache.projectStatusEnum(defaultProjectStatuses))
+
 	return &Models{
 		Projects:                ProjectModel{DB: db},
 		Resources:               ResourceModel{DB: db},
 		ResourceRequests:        ResourceRequestModel{DB: db},
 		ResourceRequestComments: ResourceRequestCommentModel{DB: db},
 		ResourceAssignments:     ResourceAssignmentModel{DB: db},
+		ResourceCertifications:  ResourceCertificationModel{DB: db},
+		Search:                  SearchModel{DB: db},
+		References:              ReferenceModel{DB: db},
+		System:                  SystemModel{DB: db},
+		Jobs:                    JobModel{DB: db},
+		Notifications:           NotificationModel{DB: db},
+		Webhooks:                WebhookModel{DB: db},
+		Events:                  EventModel{DB: db},
+		Roster:                  RosterModel{DB: db},
+		Changepoint:             ChangepointModel{DB: db},
+		ReferenceData:           cache,
 	}
 }
@@ -0,0 +1,415 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// NotificationEventTypes are the staffing events users can be emailed about.
+// Events are recorded by database triggers, or by the certification expiry
+// job, in the same transaction as the change that caused them.
+var NotificationEventTypes = []string{
+	"assignment.created",
+	"assignment.changed",
+	"assignment.ended",
+	"request.opened",
+	"request.closed",
+	"certification.expiring",
+}
+
+// Notification is a single email in the outbox.
+type Notification struct {
+	ID         int64          `json:"id"`
+	EventID    int64          `json:"eventID"`
+	EmployeeID int64          `json:"employeeID"`
+	Recipient  string         `json:"recipient"`
+	Template   string         `json:"template"`
+	Data       map[string]any `json:"data"`
+	Status     string         `json:"status"`
+	Attempts   int            `json:"attempts"`
+	LastError  string         `json:"lastError,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	SentAt     *time.Time     `json:"sentAt,omitempty"`
+}
+
+func ValidateNotificationPreferences(v *validator.Validator, prefs map[string]bool) {
+	for eventType := range prefs {
+		v.At("preferences").CheckCode(validator.PermittedValue(eventType, NotificationEventTypes...), eventType,
+			validator.CodeNotPermitted, "is not a notification event type")
+	}
+}
+
+type recipient struct {
+	employeeID  int64
+	name        string
+	email       string
+	projectID   string
+	projectName string
+}
+
+// recipientQueries find who is told about each kind of event: the assigned
+// consultant for assignments, the project manager for requests and the
+// certificate holder for expiries.
+var recipientQueries = map[string]string{
+	"assignment": `
+		SELECT r.employee_id, r.name, r.email, p.opportunity_id, p.name
+		FROM resource r, resource_request rr
+			INNER JOIN project p ON p.opportunity_id=rr.opportunity_id
+		WHERE r.employee_id=($1::jsonb->>'employee_id')::int
+		AND rr.request_id=($1::jsonb->>'resource_request_id')::bigint
+		AND r.active IS NOT FALSE`,
+	"request": `
+		SELECT r.employee_id, r.name, r.email, p.opportunity_id, p.name
+		FROM (resource_request rr
+			INNER JOIN project p ON p.opportunity_id=rr.opportunity_id)
+			INNER JOIN resource r ON r.employee_id=p.project_manager_id
+		WHERE rr.request_id=($1::jsonb->>'request_id')::bigint
+		AND r.active IS NOT FALSE`,
+	"certification": `
+		SELECT r.employee_id, r.name, r.email, '', ''
+		FROM resource r
+		WHERE r.employee_id=($1::jsonb->>'employee_id')::int
+		AND r.active IS NOT FALSE`,
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// Dispatch turns up to limit pending events into outbox entries, honouring
+// each recipient's preferences, and queues a send job for each entry. It
+// returns the number of events processed.
+func (m *NotificationModel) Dispatch(limit int, sendJobKind string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT event_id, event_type, payload
+		FROM notification_event
+		WHERE dispatched_at IS NULL
+		ORDER BY event_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type event struct {
+		id        int64
+		eventType string
+		payload   []byte
+	}
+
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.eventType, &e.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		recipients, err := eventRecipients(ctx, tx, e.eventType, e.payload)
+		if err != nil {
+			return 0, fmt.Errorf("event %d: %w", e.id, err)
+		}
+
+		for _, r := range recipients {
+			enabled, err := emailEnabled(ctx, tx, r.employeeID, e.eventType)
+			if err != nil {
+				return 0, err
+			}
+			if !enabled || r.email == "" {
+				continue
+			}
+
+			var data map[string]any
+			if err := json.Unmarshal(e.payload, &data); err != nil {
+				return 0, err
+			}
+			data["recipientName"] = r.name
+			data["projectID"] = r.projectID
+			data["projectName"] = r.projectName
+
+			js, err := json.Marshal(data)
+			if err != nil {
+				return 0, err
+			}
+
+			var id int64
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO notification (event_id, employee_id, recipient, template, data)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING notification_id`,
+				e.id, r.employeeID, r.email, strings.ReplaceAll(e.eventType, ".", "_")+".tmpl", string(js)).Scan(&id)
+			if err != nil {
+				return 0, err
+			}
+
+			payload, _ := json.Marshal(map[string]int64{"id": id})
+			job := &Job{Kind: sendJobKind, Payload: payload}
+			if err := (&JobModel{}).insert(tx, job); err != nil {
+				return 0, err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE notification_event SET dispatched_at=now() WHERE event_id=$1`, e.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), tx.Commit()
+}
+
+func eventRecipients(ctx context.Context, tx *sql.Tx, eventType string, payload []byte) ([]recipient, error) {
+	entity, _, _ := strings.Cut(eventType, ".")
+
+	query, ok := recipientQueries[entity]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification event type %q", eventType)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, string(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.employeeID, &r.name, &r.email, &r.projectID, &r.projectName); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, rows.Err()
+}
+
+// emailEnabled reports whether the employee wants email for eventType.
+// Notifications are on unless the employee has switched them off.
+func emailEnabled(ctx context.Context, tx *sql.Tx, employeeID int64, eventType string) (bool, error) {
+	var enabled bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT email FROM notification_preference
+		WHERE employee_id=$1 AND event_type=$2`, employeeID, eventType).Scan(&enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+func (m *NotificationModel) Get(id int64) (*Notification, error) {
+	query := `
+		SELECT notification_id, event_id, employee_id, recipient, template, data, status, attempts,
+			COALESCE(last_error, ''), created_at, sent_at
+		FROM notification
+		WHERE notification_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var n Notification
+	var data []byte
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&n.ID,
+		&n.EventID,
+		&n.EmployeeID,
+		&n.Recipient,
+		&n.Template,
+		&data,
+		&n.Status,
+		&n.Attempts,
+		&n.LastError,
+		&n.CreatedAt,
+		&n.SentAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(data, &n.Data); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// RecordAttempt stores the outcome of trying to send a notification.
+func (m *NotificationModel) RecordAttempt(id int64, sendErr error) error {
+	query := `
+		UPDATE notification
+		SET attempts=attempts+1, status='sent', sent_at=now(), last_error=NULL
+		WHERE notification_id=$1`
+	args := []any{id}
+
+	if sendErr != nil {
+		query = `
+			UPDATE notification
+			SET attempts=attempts+1, status='failed', last_error=$2
+			WHERE notification_id=$1`
+		args = append(args, sendErr.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// QueueCertificationExpiry records an event for each certification that
+// expires within the next days days. Each expiry is only recorded once.
+func (m *NotificationModel) QueueCertificationExpiry(days int) (int64, error) {
+	query := `
+		INSERT INTO notification_event (event_type, payload, dedupe_key)
+		SELECT 'certification.expiring',
+			json_build_object('employee_id', employee_id, 'certification', certification, 'expires_on', expires_on),
+			'certification.expiring:' || employee_id || ':' || certification || ':' || expires_on
+		FROM resource_certification
+		WHERE expires_on BETWEEN current_date AND current_date + $1::int
+		ON CONFLICT (dedupe_key) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, days)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetPreferences returns whether email is enabled for every event type.
+func (m *NotificationModel) GetPreferences(employeeID int64) (map[string]bool, error) {
+	query := `
+		SELECT event_type, email
+		FROM notification_preference
+		WHERE employee_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]bool, len(NotificationEventTypes))
+	for _, eventType := range NotificationEventTypes {
+		prefs[eventType] = true
+	}
+
+	for rows.Next() {
+		var eventType string
+		var email bool
+		if err := rows.Scan(&eventType, &email); err != nil {
+			return nil, err
+		}
+		prefs[eventType] = email
+	}
+
+	return prefs, rows.Err()
+}
+
+func (m *NotificationModel) UpdatePreferences(employeeID int64, prefs map[string]bool) error {
+	query := `
+		INSERT INTO notification_preference (employee_id, event_type, email)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (employee_id, event_type) DO UPDATE SET email=EXCLUDED.email`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for eventType, email := range prefs {
+		_, err := tx.ExecContext(ctx, query, employeeID, eventType, email)
+		if err != nil {
+			return constraintError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBefore removes notifications created before cutoff, and then the
+// dispatched events recorded before cutoff that have no notifications left.
+// Certification expiry events are kept until the expiry date has passed,
+// as their dedupe keys stop the same expiry being queued twice.
+func (m *NotificationModel) DeleteBefore(cutoff time.Time) (notifications, events int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM notification
+		WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	notifications, err = result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		DELETE FROM notification_event e
+		WHERE e.dispatched_at < $1
+		AND NOT (e.event_type = 'certification.expiring' AND (e.payload->>'expires_on')::date >= current_date)
+		AND NOT EXISTS (SELECT 1 FROM notification n WHERE n.event_id=e.event_id)`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	events, err = result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return notifications, events, tx.Commit()
+}
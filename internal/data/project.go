@@ -11,62 +11,37 @@ import (
 )
 
 type Project struct {
-	OpportunityID    string             `json:"opportunityId"`
-	ChangepointID    string             `json:"changepointId,omitempty"`
-	RevenueType      string             `json:"revenueType"`
-	Name             string             `json:"name"`
-	Customer         string             `json:"customer"`
-	EndCustomer      string             `json:"endCustomer,omitempty"`
-	ProjectManager   string             `json:"projectManager"`
-	Status           string             `json:"status"`
+	OpportunityID    string             `json:"opportunityId" validate:"required,max=64"`
+	ChangepointID    string             `json:"changepointId,omitempty" validate:"max=64"`
+	RevenueType      string             `json:"revenueType" validate:"enum=revenueType"`
+	Name             string             `json:"name" validate:"required,max=256"`
+	Customer         string             `json:"customer" validate:"required,max=255"`
+	EndCustomer      string             `json:"endCustomer,omitempty" validate:"max=255"`
+	ProjectManager   Ref                `json:"projectManager"`
+	Status           string             `json:"status" validate:"enum=projectStatus"`
 	ResourceRequests []*ResourceRequest `json:"resourceRequests,omitempty"`
 }
 
-func ValidateRevenueType(v *validator.Validator, revenueType string) {
-	revenueTypes := []string{
-		"Fixed Fee",
-		"T&M",
-	}
-	v.Check(validator.PermittedValue(revenueType, revenueTypes...), "revenueType", "is not a recognised revenue type [T&M, FF]")
-}
+var defaultProjectStatuses = validator.StaticEnum{"Staged", "At Risk", "Work in progress", "Inactive", "Complete"}
 
-func ValidateProjectName(v *validator.Validator, name string) {
-	v.Check(name != "", "name", "must be provided")
-	v.Check(len(name) <= 256, "name", "cannot be more than 256 bytes")
+func init() {
+	validator.RegisterEnum("revenueType", validator.StaticEnum{"Fixed Fee", "T&M"})
+	validator.RegisterEnum("projectStatus", defaultProjectStatuses)
 }
 
-func ValidateCustomer(v *validator.Validator, customer string) {
-	v.Check(customer != "", "customer", "must be provided")
-	v.Check(len(customer) < 256, "customer", "cannot be more than 256 bytes")
-}
-
-func ValidateProjectManager(v *validator.Validator, projectManager string) {
+func ValidateProjectManager(v *validator.Validator, projectManager Ref) {
+	ValidateRef(v, "projectManager", projectManager)
 	// TODO: Change this to pull PMs from database into cache on start
 	projectManagers := []string{
 		"Kim Slocum",
 		"Nisha Halim",
 	}
-	v.Check(validator.PermittedValue(projectManager, projectManagers...), "projectManager", "is not a Project Manager")
-}
-
-func ValidateStatus(v *validator.Validator, status string) {
-	// TODO: Change this to pull statuses from database into cache at start
-	statuses := []string{
-		"Staged",
-		"At Risk",
-		"Work in progress",
-		"Inactive",
-		"Complete",
-	}
-	v.Check(validator.PermittedValue(status, statuses...), "status", "is not a recognised status")
+	v.CheckCode(projectManager.Name == "" || validator.PermittedValue(projectManager.Name, projectManagers...), "projectManager", validator.CodeNotPermitted, "is not a Project Manager")
 }
 
 func ValidateProject(v *validator.Validator, project Project) {
-	ValidateRevenueType(v, project.RevenueType)
-	ValidateName(v, project.Name)
-	ValidateCustomer(v, project.Customer)
+	v.Struct(project)
 	ValidateProjectManager(v, project.ProjectManager)
-	ValidateStatus(v, project.Status)
 }
 
 type ProjectModel struct {
@@ -77,9 +52,9 @@ func (m *ProjectModel) Insert(p *Project) error {
 	query := `
 		INSERT INTO project
 		(opportunity_id, changepoint_id, revenue_type, name, customer, end_customer, project_manager_id, status_id)
-		VALUES ($1, $2, $3, $4, $5, $6
-			   (SELECT employee_id FROM resource WHERE name=$7),
-			   (SELECT status_id FROM project_status WHERE status=$8))`
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+			   (SELECT status_id FROM project_status WHERE status=$8))
+		RETURNING opportunity_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -91,11 +66,16 @@ func (m *ProjectModel) Insert(p *Project) error {
 		p.Name,
 		p.Customer,
 		p.EndCustomer,
-		p.ProjectManager,
+		p.ProjectManager.ID,
 		p.Status,
 	}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&p.OpportunityID)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
 }
 
 func (m *ProjectModel) Get(id string) (*Project, error) {
@@ -104,7 +84,7 @@ func (m *ProjectModel) Get(id string) (*Project, error) {
 	}
 
 	query := `
-		SELECT p.changepoint_id, p.revenue_type, p.name, p.customer, p.end_customer, r.name, ps.status
+		SELECT p.changepoint_id, p.revenue_type, p.name, p.customer, COALESCE(p.end_customer, ''), r.employee_id, r.name, ps.status
 		FROM((project p
 			INNER JOIN resource r ON r.employee_id=p.project_manager_id)
 			INNER JOIN project_status ps ON p.status_id=ps.status_id)
@@ -122,7 +102,8 @@ func (m *ProjectModel) Get(id string) (*Project, error) {
 		&p.Name,
 		&p.Customer,
 		&p.EndCustomer,
-		&p.ProjectManager,
+		&p.ProjectManager.ID,
+		&p.ProjectManager.Name,
 		&p.Status,
 	)
 	if err != nil {
@@ -141,9 +122,10 @@ func (m *ProjectModel) Update(p *Project) error {
 	query := `
 		UPDATE project
 		SET changepoint_id=$1, revenue_type=$2, name=$3, customer=$4, end_customer=$5,
-		    project_manager_id=(SELECT id FROM resources WHERE resources.name=$6),
+		    project_manager_id=$6,
 			status_id=(SELECT status_id FROM project_status WHERE status=$7)
-		WHERE opportunity_id=$8`
+		WHERE opportunity_id=$8
+		RETURNING opportunity_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -154,26 +136,25 @@ func (m *ProjectModel) Update(p *Project) error {
 		p.Name,
 		p.Customer,
 		p.EndCustomer,
-		p.ProjectManager,
+		p.ProjectManager.ID,
 		p.Status,
 		p.OpportunityID,
 	}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&p.OpportunityID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return constraintError(err)
 		}
 	}
 	return nil
 }
 
 func (m *ProjectModel) GetAll(customer, endCustomer, projectManager, status, revenueType, changepointID string, filters Filters) ([]*Project, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), p.opportunity_id, p.changepoint_id, p.name, p.revenue_type, p.customer, p.end_customer, r.name, ps.status
+	from := `
 		FROM ((project p
 			INNER JOIN resource r ON r.employee_id=p.project_manager_id)
 			INNER JOIN project_status ps ON ps.status_id=p.status_id)
@@ -182,14 +163,45 @@ func (m *ProjectModel) GetAll(customer, endCustomer, projectManager, status, rev
 		AND (r.name=$3 OR $3='')
 		AND (ps.status=$4 or $4='')
 		AND (p.revenue_type::text=$5 OR $5='')
-		AND (p.changepoint_id = $6 OR $6='')
-		ORDER BY %s %s, opportunity_id ASC
-		LIMIT $7 OFFSET $8`, fmt.Sprintf("p.%s", filters.sortColumn()), filters.sortDirection())
+		AND (p.changepoint_id = $6 OR $6='')`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	args := []interface{}{customer, endCustomer, projectManager, status, revenueType, changepointID, filters.limit(), filters.offset()}
+	args := []interface{}{customer, endCustomer, projectManager, status, revenueType, changepointID}
+
+	from += filters.Expr.where(&args)
+
+	totalRecords := 0
+	if !filters.SkipCount {
+		err := m.DB.QueryRowContext(ctx, "SELECT count(*)"+from, args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	// end_customer is optional. NULLs are sorted as empty strings, matching
+	// the cursor value taken from the scanned project, so that projects
+	// without one are not lost from keyset pages.
+	sortExpr := fmt.Sprintf("p.%s", filters.sortColumn())
+	switch filters.sortColumn() {
+	case "project_manager":
+		sortExpr = "r.name"
+	case "end_customer":
+		sortExpr = "COALESCE(p.end_customer, '')"
+	}
+
+	keyset, keysetArgs := filters.keysetCondition(sortExpr, "p.opportunity_id", len(args)+1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT p.opportunity_id, p.changepoint_id, p.name, p.revenue_type, p.customer, COALESCE(p.end_customer, ''), r.employee_id, r.name, ps.status
+		%s
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, from, keyset, filters.orderBy(sortExpr, "p.opportunity_id"), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit()+1, filters.offset())
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -197,20 +209,19 @@ func (m *ProjectModel) GetAll(customer, endCustomer, projectManager, status, rev
 	}
 	defer rows.Close()
 
-	totalRecords := 0
 	projects := []*Project{}
 
 	for rows.Next() {
 		var project Project
 		err := rows.Scan(
-			&totalRecords,
 			&project.OpportunityID,
 			&project.ChangepointID,
 			&project.Name,
 			&project.RevenueType,
 			&project.Customer,
 			&project.EndCustomer,
-			&project.ProjectManager,
+			&project.ProjectManager.ID,
+			&project.ProjectManager.Name,
 			&project.Status,
 		)
 		if err != nil {
@@ -219,7 +230,105 @@ func (m *ProjectModel) GetAll(customer, endCustomer, projectManager, status, rev
 		projects = append(projects, &project)
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	projects, metadata := keysetPage(filters, projects, totalRecords, func(p *Project) (string, string) {
+		switch filters.sortColumn() {
+		case "customer":
+			return p.Customer, p.OpportunityID
+		case "end_customer":
+			return p.EndCustomer, p.OpportunityID
+		case "project_manager":
+			return p.ProjectManager.Name, p.OpportunityID
+		default:
+			return p.OpportunityID, p.OpportunityID
+		}
+	})
 
 	return projects, metadata, nil
 }
+
+type ProjectIncludes struct {
+	Requests    bool
+	Comments    bool
+	Assignments bool
+}
+
+func ValidateProjectIncludes(v *validator.Validator, includes []string) {
+	for _, include := range includes {
+		v.CheckCode(validator.PermittedValue(include, "requests", "comments", "assignments"), "include", validator.CodeNotPermitted, "must be a comma separated list of [requests, comments, assignments]")
+	}
+}
+
+func NewProjectIncludes(includes []string) ProjectIncludes {
+	var inc ProjectIncludes
+
+	for _, include := range includes {
+		switch include {
+		case "requests":
+			inc.Requests = true
+		case "comments":
+			inc.Requests = true
+			inc.Comments = true
+		case "assignments":
+			inc.Requests = true
+			inc.Assignments = true
+		}
+	}
+
+	return inc
+}
+
+// GetAggregate loads a project along with the related records selected by inc.
+// Child records are fetched with one query per table rather than one per request.
+func (m *ProjectModel) GetAggregate(id string, inc ProjectIncludes) (*Project, error) {
+	project, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inc.Requests {
+		return project, nil
+	}
+
+	requests := ResourceRequestModel{DB: m.DB}
+	resourceRequests, err := requests.GetForOpportunity(id)
+	if err != nil {
+		return nil, err
+	}
+
+	project.ResourceRequests = resourceRequests
+
+	if len(resourceRequests) == 0 || !(inc.Comments || inc.Assignments) {
+		return project, nil
+	}
+
+	reqIDs := make([]int64, len(resourceRequests))
+	for i, req := range resourceRequests {
+		reqIDs[i] = req.ID
+	}
+
+	if inc.Comments {
+		comments := ResourceRequestCommentModel{DB: m.DB}
+		byRequest, err := comments.GetForRequests(reqIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, req := range resourceRequests {
+			req.Comments = byRequest[req.ID]
+		}
+	}
+
+	if inc.Assignments {
+		assignments := ResourceAssignmentModel{DB: m.DB}
+		byRequest, err := assignments.GetForRequests(reqIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, req := range resourceRequests {
+			req.Assignments = byRequest[req.ID]
+		}
+	}
+
+	return project, nil
+}
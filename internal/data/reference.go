@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+var (
+	ErrAmbiguousRef = errors.New("ambiguous reference")
+	ErrRefMismatch  = errors.New("reference id and name do not match")
+)
+
+// Ref is a reference to another record. Clients may send it as an id, a name
+// or an object with either or both; it is always returned as an object.
+type Ref struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+func (r *Ref) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	var id int64
+	if err := json.Unmarshal(b, &id); err == nil {
+		*r = Ref{ID: id}
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*r = Ref{Name: name}
+		return nil
+	}
+
+	var aux struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return errors.New("reference must be an id, a name or an object with an id or name")
+	}
+
+	*r = Ref{ID: aux.ID, Name: aux.Name}
+	return nil
+}
+
+func (r Ref) IsZero() bool {
+	return r.ID == 0 && r.Name == ""
+}
+
+func ValidateRef(v *validator.Validator, key string, ref Ref) {
+	v.CheckCode(!ref.IsZero(), key, validator.CodeRequired, "must be provided")
+	v.Check(ref.ID >= 0, key, "cannot have a negative id")
+}
+
+type RefKind int
+
+const (
+	RefJobTitle RefKind = iota
+	RefWorkgroup
+	RefResource
+)
+
+var refTables = map[RefKind]struct {
+	table, id, name string
+}{
+	RefJobTitle:  {"job_title", "title_id", "title"},
+	RefWorkgroup: {"workgroup", "workgroup_id", "workgroup_name"},
+	RefResource:  {"resource", "employee_id", "name"},
+}
+
+type ReferenceModel struct {
+	DB *sql.DB
+}
+
+// Lookup completes ref from the database. A reference by name must match
+// exactly one record, otherwise ErrNotFound or ErrAmbiguousRef is returned.
+func (m *ReferenceModel) Lookup(kind RefKind, ref *Ref) error {
+	t := refTables[kind]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if ref.ID != 0 {
+		query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s=$1`, t.name, t.table, t.id)
+
+		var name string
+		err := m.DB.QueryRowContext(ctx, query, ref.ID).Scan(&name)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if ref.Name != "" && !strings.EqualFold(ref.Name, name) {
+			return ErrRefMismatch
+		}
+
+		ref.Name = name
+		return nil
+	}
+
+	query := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s=$1 LIMIT 2`, t.id, t.name, t.table, t.name)
+
+	rows, err := m.DB.QueryContext(ctx, query, ref.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var matches []Ref
+	for rows.Next() {
+		var match Ref
+		if err := rows.Scan(&match.ID, &match.Name); err != nil {
+			return err
+		}
+		matches = append(matches, match)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	switch len(matches) {
+	case 0:
+		return ErrNotFound
+	case 1:
+		*ref = matches[0]
+		return nil
+	default:
+		return ErrAmbiguousRef
+	}
+}
+
+// Resolve looks up ref and records unresolved references on v under key. Only
+// unexpected database errors are returned.
+func (m *ReferenceModel) Resolve(v *validator.Validator, key string, kind RefKind, ref *Ref) error {
+	if ref.IsZero() || ref.ID < 0 {
+		return nil
+	}
+
+	err := m.Lookup(kind, ref)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound):
+		v.AddErrorCode(key, validator.CodeNotFound, "does not exist")
+	case errors.Is(err, ErrAmbiguousRef):
+		v.AddErrorCode(key, validator.CodeAmbiguous, "matches more than one record, please specify an id")
+	case errors.Is(err, ErrRefMismatch):
+		v.AddError(key, "id and name refer to different records")
+	default:
+		return err
+	}
+	return nil
+}
+
+func (m *ReferenceModel) ResolveResource(v *validator.Validator, r *Resource) error {
+	if err := m.Resolve(v, "jobTitle", RefJobTitle, &r.JobTitle); err != nil {
+		return err
+	}
+	if err := m.Resolve(v, "manager", RefResource, &r.Manager); err != nil {
+		return err
+	}
+	return m.Resolve(v, "workgroup", RefWorkgroup, &r.Workgroup)
+}
+
+func (m *ReferenceModel) ResolveProject(v *validator.Validator, p *Project) error {
+	return m.Resolve(v, "projectManager", RefResource, &p.ProjectManager)
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// ReferenceCache holds slowly changing lookup values in memory so validation
+// does not need a query per request.
+type ReferenceCache struct {
+	DB *sql.DB
+
+	mu              sync.RWMutex
+	projectStatuses []string
+	loadedAt        time.Time
+}
+
+func (c *ReferenceCache) Refresh() error {
+	query := `
+		SELECT status
+		FROM project_status
+		ORDER BY status_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statuses := []string{}
+
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.projectStatuses = statuses
+	c.loadedAt = time.Now()
+
+	return nil
+}
+
+func (c *ReferenceCache) LoadedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loadedAt
+}
+
+// projectStatusEnum falls back to fallback until the cache has been loaded
+// with at least one status.
+func (c *ReferenceCache) projectStatusEnum(fallback validator.EnumProvider) validator.EnumProvider {
+	return validator.EnumFunc(func() []string {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+
+		if len(c.projectStatuses) == 0 {
+			return fallback.Values()
+		}
+		return c.projectStatuses
+	})
+}
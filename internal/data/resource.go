@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/lib/pq"
@@ -12,50 +13,36 @@ import (
 )
 
 type Resource struct {
-	ID             int64    `json:"id"`
-	Name           string   `json:"name"`
-	Email          string   `json:"email"`
-	JobTitle       string   `json:"jobTitle"`
-	Manager        string   `json:"manager"`
-	Workgroup      string   `json:"workgroup"`
-	Clearance      string   `json:"clearance"`
-	Specialties    []string `json:"specialties"`
-	Certifications []string `json:"certifications"`
+	ID             int64    `json:"id" validate:"required,min=1"`
+	Name           string   `json:"name" validate:"required,max=255"`
+	Email          string   `json:"email" validate:"required,email,max=255"`
+	JobTitle       Ref      `json:"jobTitle"`
+	Manager        Ref      `json:"manager"`
+	Workgroup      Ref      `json:"workgroup"`
+	Clearance      string   `json:"clearance" validate:"enum=clearance"`
+	Specialties    []string `json:"specialties" validate:"unique"`
+	Certifications []string `json:"certifications" validate:"unique"`
 	Active         bool     `json:"active"`
+	Score          float64  `json:"score,omitempty" csv:"-"`
 }
 
-func ValidateID(v *validator.Validator, id int64) {
-	v.Check(id != 0, "id", "must be provided")
-	v.Check(id > 0, "id", "cannot be a negative number")
+type ResourceSuggestion struct {
+	ID    int64   `json:"id"`
+	Name  string  `json:"name"`
+	Email string  `json:"email"`
+	Score float64 `json:"score"`
 }
 
-func ValidateName(v *validator.Validator, name string) {
-	v.Check(name != "", "firstName", "must be provided")
-	v.Check(len(name) < 256, "firstName", "cannot be more than 256 bytes")
+func init() {
+	validator.RegisterEnum("clearance", validator.StaticEnum{"None", "Baseline", "NV1", "NV2", "TSPV"})
 }
 
-func ValidateJobTitle(v *validator.Validator, jobTitle string) {
-	// TODO: Remove this hard-coding
-	jobTitles := []string{
-		"Associate Project Manager I",
-		"Associate Consultant I",
-		"Associate Project Manager II",
-		"Associate Consultant II",
-		"Project Manager",
-		"Consultant",
-		"Senior Project Manager",
-		"Senior Consultant",
-		"Staff Consultant",
-		"Consulting Architect",
-		"Staff Consulting Architect",
-		"Manager - Professional Services - Delivery",
-		"Senior Manager - Professional Services - Delivery",
-		"Director - Professional Services - Delivery",
-	}
-	v.Check(validator.PermittedValue(jobTitle, jobTitles...), "jobTitle", "does not exist")
+func ValidateJobTitle(v *validator.Validator, jobTitle Ref) {
+	ValidateRef(v, "jobTitle", jobTitle)
 }
 
-func ValidateManager(v *validator.Validator, manager string) {
+func ValidateManager(v *validator.Validator, manager Ref) {
+	ValidateRef(v, "manager", manager)
 	// TODO: remove this hard-coding
 	managers := []string{
 		"Caroline Dimitrovski",
@@ -64,42 +51,29 @@ func ValidateManager(v *validator.Validator, manager string) {
 		"Peter Stacey",
 		"Deborah Brathwaite",
 	}
-	v.Check(validator.PermittedValue(manager, managers...), "manager", "is not a manager")
-}
-
-func ValidateWorkgroup(v *validator.Validator, workgroup string) {
-	// TODO: Remove this hard-coding
-	workgroups := []string{
-		"APJ - Managers and Non-Billable",
-		"Architects - ANZ",
-		"PMO - ANZ",
-		"Retainer - ANZ",
-		"Server - Australia",
-	}
-	v.Check(validator.PermittedValue(workgroup, workgroups...), "workgroup", "does not exist")
+	v.CheckCode(manager.Name == "" || validator.PermittedValue(manager.Name, managers...), "manager", validator.CodeNotPermitted, "is not a manager")
 }
 
-func ValidatorClearance(v *validator.Validator, clearance string) {
-
-	clearances := []string{
-		"None",
-		"Baseline",
-		"NV1",
-		"NV2",
-		"TSPV",
-	}
-	v.Check(validator.PermittedValue(clearance, clearances...), "clearance", "must be one of ['None', 'Baseline', 'NV1', 'NV2', 'TSPV']")
+func ValidateWorkgroup(v *validator.Validator, workgroup Ref) {
+	ValidateRef(v, "workgroup", workgroup)
 }
 
 func ValidateResource(v *validator.Validator, r Resource) {
-	ValidateID(v, r.ID)
-	ValidateName(v, r.Name)
+	v.Struct(r)
 	ValidateJobTitle(v, r.JobTitle)
 	ValidateManager(v, r.Manager)
 	ValidateWorkgroup(v, r.Workgroup)
-	ValidatorClearance(v, r.Clearance)
-	v.Check(validator.Unique(r.Specialties), "specialties", "cannot contain duplicate values")
-	v.Check(validator.Unique(r.Certifications), "certifications", "cannot contain duplicate values")
+}
+
+func ValidateNameMatch(v *validator.Validator, nameMatch string) {
+	v.CheckCode(validator.PermittedValue(nameMatch, "exact", "prefix", "fuzzy"), "nameMatch", validator.CodeNotPermitted, "must be one of [exact, prefix, fuzzy]")
+}
+
+func ValidateAutocomplete(v *validator.Validator, q string, limit int) {
+	v.CheckCode(q != "", "q", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(q) <= 256, "q", validator.CodeTooLong, "cannot be more than 256 bytes")
+	v.CheckCode(limit > 0, "limit", validator.CodeOutOfRange, "must be a positive integer")
+	v.CheckCode(limit <= 25, "limit", validator.CodeOutOfRange, "must be a maximum of 25")
 }
 
 type ResourceModel struct {
@@ -110,19 +84,15 @@ func (m *ResourceModel) Insert(r *Resource) error {
 	query := `
 		INSERT INTO resource
 		(employee_id, name, email, job_title_id, manager_id, workgroup_id, clearance, specialties, certifications, active)
-		VALUES ($1, $2, $3, 
-			   (SELECT title_id FROM job_title WHERE title=$4),
-			   (SELECT m.id FROM resource m WHERE m.name=$5),
-			   (SELECT workgroup_id FROM workgroup WHERE name=$6), 
-			   $7, $8, $9, $10) RETURNING active`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING active`
 
 	args := []interface{}{
 		r.ID,
 		r.Name,
 		r.Email,
-		r.JobTitle,
-		r.Manager,
-		r.Workgroup,
+		r.JobTitle.ID,
+		r.Manager.ID,
+		r.Workgroup.ID,
 		r.Clearance,
 		pq.Array(r.Specialties),
 		pq.Array(r.Certifications),
@@ -132,7 +102,12 @@ func (m *ResourceModel) Insert(r *Resource) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&r.Active)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&r.Active)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
 }
 
 func (m *ResourceModel) Get(id int64) (*Resource, error) {
@@ -141,12 +116,13 @@ func (m *ResourceModel) Get(id int64) (*Resource, error) {
 	}
 
 	query := `
-		SELECT r.employee_id, r.name, r.email, job_title.title, m.name AS manager, workgroup.name, r.clearance, r.specialties, r.certifications, r.active
+		SELECT r.name, r.email, job_title.title_id, job_title.title, m.employee_id, m.name AS manager,
+			workgroup.workgroup_id, workgroup.workgroup_name, r.clearance, r.specialties, r.certifications, r.active
 		FROM (((resource r
 			INNER JOIN job_title ON r.job_title_id=job_title.title_id)
-			INNER JOIN resource m ON resource.manager_id=m.id)
-			INNER JOIN workgroup ON workgroup.workgroup_id=resource.workgroup_id)
-		WHERE resource.id=$1`
+			INNER JOIN resource m ON r.manager_id=m.employee_id)
+			INNER JOIN workgroup ON workgroup.workgroup_id=r.workgroup_id)
+		WHERE r.employee_id=$1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -157,9 +133,12 @@ func (m *ResourceModel) Get(id int64) (*Resource, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&r.Name,
 		&r.Email,
-		&r.JobTitle,
-		&r.Manager,
-		&r.Workgroup,
+		&r.JobTitle.ID,
+		&r.JobTitle.Name,
+		&r.Manager.ID,
+		&r.Manager.Name,
+		&r.Workgroup.ID,
+		&r.Workgroup.Name,
 		&r.Clearance,
 		pq.Array(&r.Specialties),
 		pq.Array(&r.Certifications),
@@ -180,12 +159,10 @@ func (m *ResourceModel) Get(id int64) (*Resource, error) {
 func (m *ResourceModel) Update(r *Resource) error {
 	query := `
 		UPDATE resource
-		SET name=$1, email=$2,
-		    job_title_id=(SELECT title_id FROM job_title WHERE title=$3), 
-		    manager_id=(SELECT m.id FROM resource m WHERE m.name=$4), 
-			workgroup_id=(SELECT workgroup_id FROM workgroup WHERE name=$5), 
+		SET name=$1, email=$2, job_title_id=$3, manager_id=$4, workgroup_id=$5,
 			clearance=$6, specialties=$7, certifications=$8, active=$9
-		WHERE id=$10`
+		WHERE employee_id=$10
+		RETURNING employee_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -193,9 +170,9 @@ func (m *ResourceModel) Update(r *Resource) error {
 	args := []interface{}{
 		r.Name,
 		r.Email,
-		r.JobTitle,
-		r.Manager,
-		r.Workgroup,
+		r.JobTitle.ID,
+		r.Manager.ID,
+		r.Workgroup.ID,
 		r.Clearance,
 		pq.Array(r.Specialties),
 		pq.Array(r.Certifications),
@@ -203,22 +180,35 @@ func (m *ResourceModel) Update(r *Resource) error {
 		r.ID,
 	}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return constraintError(err)
 		}
 	}
 	return nil
 }
 
-func (m *ResourceModel) GetAll(name string, workgroups []string, clearance string, specialties []string,
+func (m *ResourceModel) GetAll(name, nameMatch string, workgroups []string, clearance string, specialties []string,
 	certifications []string, manager string, active bool, filters Filters) ([]*Resource, Metadata, error) {
-	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), r.employee_id, r.name, r.email, job_title.title, m.name AS manager, workgroup.workgroup_name, r.clearance, r.specialties, r.certifications, r.active
+	nameCondition := "r.name = $7"
+	score := "0::real"
+
+	switch nameMatch {
+	case "prefix":
+		nameCondition = "r.name ILIKE $7 OR r.email ILIKE $7"
+		if name != "" {
+			name = escapeLike(name) + "%"
+		}
+	case "fuzzy":
+		nameCondition = "r.name % $7 OR r.email % $7"
+		score = "GREATEST(similarity(r.name, $7), similarity(r.email, $7))"
+	}
+
+	from := fmt.Sprintf(`
         FROM (((resource r
             INNER JOIN job_title ON r.job_title_id=job_title.title_id)
             INNER JOIN resource m ON r.manager_id=m.employee_id)
@@ -229,9 +219,7 @@ func (m *ResourceModel) GetAll(name string, workgroups []string, clearance strin
         AND (r.certifications @> $4 OR $4 = '{}')
         AND (m.name = $5 OR $5 = '')
         AND (r.active = $6)
-        AND (r.name = $7 OR $7 = '')
-        ORDER BY %s %s, r.employee_id ASC
-        LIMIT $8 OFFSET $9`, fmt.Sprintf("r.%s", filters.sortColumn()), filters.sortDirection())
+        AND ($7 = '' OR %s)`, nameCondition)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -244,33 +232,57 @@ func (m *ResourceModel) GetAll(name string, workgroups []string, clearance strin
 		manager,
 		active,
 		name,
-		filters.limit(),
-		filters.offset(),
 	}
 
+	from += filters.Expr.where(&args)
+
+	totalRecords := 0
+	if !filters.SkipCount {
+		err := m.DB.QueryRowContext(ctx, "SELECT count(*)"+from, args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	sortExpr := fmt.Sprintf("r.%s", filters.sortColumn())
+	keyset, keysetArgs := filters.keysetCondition(sortExpr, "r.employee_id", len(args)+1)
+	args = append(args, keysetArgs...)
+
+	query := fmt.Sprintf(`
+        SELECT r.employee_id, r.name, r.email, job_title.title_id, job_title.title, m.employee_id, m.name AS manager,
+            workgroup.workgroup_id, workgroup.workgroup_name, r.clearance, r.specialties, r.certifications, r.active, %s
+        %s
+        %s
+        ORDER BY %s
+        LIMIT $%d OFFSET $%d`, score, from, keyset, filters.orderBy(sortExpr, "r.employee_id"), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit()+1, filters.offset())
+
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
-	totalRecords := 0
 	resources := []*Resource{}
 
 	for rows.Next() {
 		var resource Resource
 		err := rows.Scan(
-			&totalRecords,
 			&resource.ID,
 			&resource.Name,
 			&resource.Email,
-			&resource.JobTitle,
-			&resource.Manager,
-			&resource.Workgroup,
+			&resource.JobTitle.ID,
+			&resource.JobTitle.Name,
+			&resource.Manager.ID,
+			&resource.Manager.Name,
+			&resource.Workgroup.ID,
+			&resource.Workgroup.Name,
 			&resource.Clearance,
 			pq.Array(&resource.Specialties),
 			pq.Array(&resource.Certifications),
 			&resource.Active,
+			&resource.Score,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -278,7 +290,75 @@ func (m *ResourceModel) GetAll(name string, workgroups []string, clearance strin
 		resources = append(resources, &resource)
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	resources, metadata := keysetPage(filters, resources, totalRecords, func(r *Resource) (string, string) {
+		id := strconv.FormatInt(r.ID, 10)
+		if filters.sortColumn() == "name" {
+			return r.Name, id
+		}
+		return id, id
+	})
 
 	return resources, metadata, nil
 }
+
+func (m *ResourceModel) Autocomplete(q string, limit int) ([]*ResourceSuggestion, error) {
+	query := `
+		SELECT employee_id, name, email, GREATEST(similarity(name, $1), similarity(email, $1)) AS score
+		FROM resource
+		WHERE active
+		AND (name ILIKE $2 OR email ILIKE $2 OR name % $1)
+		ORDER BY name ILIKE $2 DESC, score DESC, name ASC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, q, escapeLike(q)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*ResourceSuggestion{}
+
+	for rows.Next() {
+		var suggestion ResourceSuggestion
+		err := rows.Scan(
+			&suggestion.ID,
+			&suggestion.Name,
+			&suggestion.Email,
+			&suggestion.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// CountBench returns the number of active resources with no assignment
+// covering today.
+func (m *ResourceModel) CountBench() (int, error) {
+	query := `
+		SELECT count(*)
+		FROM resource r
+		WHERE r.active
+		AND NOT EXISTS (
+			SELECT 1 FROM resource_assignment a
+			WHERE a.employee_id=r.employee_id
+			AND a.start_date <= current_date
+			AND (a.end_date IS NULL OR a.end_date >= current_date))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
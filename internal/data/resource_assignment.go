@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/vmw-pso/back-end/internal/validator"
 )
 
@@ -18,7 +19,7 @@ type ResourceAssignment struct {
 }
 
 func ValidateHourPerWeek(v *validator.Validator, hoursPerWeek float64) {
-	v.Check(hoursPerWeek <= 40, "hoursPerWeek", "must be no more than 40")
+	v.CheckCode(hoursPerWeek <= 40, "hoursPerWeek", validator.CodeOutOfRange, "must be no more than 40")
 }
 
 func ValidateEndData(v *validator.Validator, a ResourceAssignment, budgetHours float64) {
@@ -71,7 +72,12 @@ func (m *ResourceAssignmentModel) Insert(a *ResourceAssignment) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&a.ID)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&a.ID)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
 }
 
 func (m *ResourceAssignmentModel) GetForRequest(reqID int64) ([]*ResourceAssignment, error) {
@@ -109,3 +115,45 @@ func (m *ResourceAssignmentModel) GetForRequest(reqID int64) ([]*ResourceAssignm
 	}
 	return assignments, nil
 }
+
+func (m *ResourceAssignmentModel) GetForRequests(reqIDs []int64) (map[int64][]*ResourceAssignment, error) {
+	query := `
+		SELECT assignment_id, resource_request_id, r.name, start_date, end_date, hours_per_week
+		FROM(resource_assignment a
+			INNER JOIN resource r ON a.employee_id=r.employee_id)
+		WHERE resource_request_id = ANY($1)
+		ORDER BY start_date ASC, assignment_id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(reqIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := make(map[int64][]*ResourceAssignment, len(reqIDs))
+
+	for rows.Next() {
+		var assignment ResourceAssignment
+		err := rows.Scan(
+			&assignment.ID,
+			&assignment.RequestID,
+			&assignment.Resource,
+			&assignment.StartDate,
+			&assignment.EndDate,
+			&assignment.HoursPerWeek,
+		)
+		if err != nil {
+			return nil, err
+		}
+		assignments[assignment.RequestID] = append(assignments[assignment.RequestID], &assignment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assignments, nil
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// ResourceCertification is a certification a resource holds and when it
+// expires. Rows are kept in step with the resource's certifications by a
+// database trigger, so only the expiry date is ever written here.
+type ResourceCertification struct {
+	Certification string     `json:"certification"`
+	ExpiresOn     *time.Time `json:"expiresOn"`
+}
+
+func ValidateResourceCertifications(v *validator.Validator, held []string, certs []ResourceCertification) {
+	for i, c := range certs {
+		cv := v.At("certifications", i)
+		cv.CheckCode(c.Certification != "", "certification", validator.CodeRequired, "must be provided")
+		cv.CheckCode(c.Certification == "" || validator.PermittedValue(c.Certification, held...), "certification",
+			validator.CodeNotPermitted, "is not held by this resource")
+	}
+}
+
+type ResourceCertificationModel struct {
+	DB *sql.DB
+}
+
+func (m *ResourceCertificationModel) GetAll(employeeID int64) ([]ResourceCertification, error) {
+	query := `
+		SELECT certification, expires_on
+		FROM resource_certification
+		WHERE employee_id=$1
+		ORDER BY certification`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []ResourceCertification{}
+	for rows.Next() {
+		var c ResourceCertification
+		if err := rows.Scan(&c.Certification, &c.ExpiresOn); err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	return certs, rows.Err()
+}
+
+// UpdateExpiry sets the expiry dates of certifications the resource holds.
+// A nil date clears the expiry.
+func (m *ResourceCertificationModel) UpdateExpiry(employeeID int64, certs []ResourceCertification) error {
+	query := `
+		UPDATE resource_certification
+		SET expires_on=$3
+		WHERE employee_id=$1 AND certification=$2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range certs {
+		_, err := tx.ExecContext(ctx, query, employeeID, c.Certification, c.ExpiresOn)
+		if err != nil {
+			return constraintError(err)
+		}
+	}
+
+	return tx.Commit()
+}
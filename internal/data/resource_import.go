@@ -0,0 +1,332 @@
+package data
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// ErrInvalidImport is returned when an import file cannot be read at all.
+var ErrInvalidImport = errors.New("invalid import file")
+
+// resourceImportColumns maps the headings used by HR exports, lower-cased
+// with spaces and punctuation removed, to the field they fill.
+var resourceImportColumns = map[string]string{
+	"employeeid":     "id",
+	"employeenumber": "id",
+	"id":             "id",
+	"name":           "name",
+	"fullname":       "name",
+	"employeename":   "name",
+	"email":          "email",
+	"emailaddress":   "email",
+	"workemail":      "email",
+	"jobtitle":       "jobTitle",
+	"title":          "jobTitle",
+	"position":       "jobTitle",
+	"manager":        "manager",
+	"managername":    "manager",
+	"managerid":      "managerId",
+	"workgroup":      "workgroup",
+	"team":           "workgroup",
+	"clearance":      "clearance",
+	"specialties":    "specialties",
+	"skills":         "specialties",
+	"certifications": "certifications",
+	"active":         "active",
+}
+
+// ResourceImportRow is one line of an import file. Validator holds any
+// problems found while parsing the line, and is used to record any found
+// when it is checked.
+type ResourceImportRow struct {
+	Line      int
+	Resource  Resource
+	Validator *validator.Validator
+}
+
+type ResourceImportError struct {
+	Line       int               `json:"line"`
+	EmployeeID int64             `json:"employeeId,omitempty"`
+	Errors     map[string]string `json:"errors"`
+}
+
+type ResourceImportReport struct {
+	DryRun  bool                  `json:"dryRun"`
+	Applied bool                  `json:"applied"`
+	Rows    int                   `json:"rows"`
+	Created int                   `json:"created"`
+	Updated int                   `json:"updated"`
+	Errors  []ResourceImportError `json:"errors"`
+}
+
+func normaliseHeading(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// splitList splits a multi-valued HR export cell, which may use semicolons,
+// pipes or commas between values.
+func splitList(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '|' || r == ',' })
+
+	values := []string{}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			values = append(values, f)
+		}
+	}
+	return values
+}
+
+func parseActive(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "true", "yes", "y", "1", "active":
+		return true, true
+	case "false", "no", "n", "0", "inactive", "terminated":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// ParseResourceCSV reads an HR export. Columns are matched by heading and
+// unknown columns are ignored. An error is only returned if the file as a
+// whole cannot be read; problems with individual lines are recorded on
+// their rows, including employee IDs and emails repeated within the file.
+func ParseResourceCSV(r io.Reader) ([]*ResourceImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	headings, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: file is empty", ErrInvalidImport)
+		}
+		return nil, importReadError(err)
+	}
+
+	columns := make(map[string]int)
+	for i, heading := range headings {
+		if i == 0 {
+			heading = strings.TrimPrefix(heading, "\ufeff")
+		}
+		if field, ok := resourceImportColumns[normaliseHeading(heading)]; ok {
+			if _, exists := columns[field]; !exists {
+				columns[field] = i
+			}
+		}
+	}
+
+	for _, field := range []string{"id", "name", "email", "jobTitle", "workgroup"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("%w: missing column for %s", ErrInvalidImport, field)
+		}
+	}
+	_, hasManager := columns["manager"]
+	_, hasManagerID := columns["managerId"]
+	if !hasManager && !hasManagerID {
+		return nil, fmt.Errorf("%w: missing column for manager", ErrInvalidImport)
+	}
+
+	var rows []*ResourceImportRow
+	seenIDs := make(map[int64]int)
+	seenEmails := make(map[string]int)
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, importReadError(err)
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		cell := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := &ResourceImportRow{Line: line, Validator: validator.New()}
+		v := row.Validator
+		res := &row.Resource
+
+		if id := cell("id"); id != "" {
+			res.ID, err = strconv.ParseInt(id, 10, 64)
+			v.CheckCode(err == nil, "id", validator.CodeBadFormat, "must be a number")
+		}
+
+		res.Name = cell("name")
+		res.Email = cell("email")
+		res.JobTitle.Name = cell("jobTitle")
+		res.Manager.Name = cell("manager")
+		res.Workgroup.Name = cell("workgroup")
+		res.Clearance = cell("clearance")
+		res.Specialties = splitList(cell("specialties"))
+		res.Certifications = splitList(cell("certifications"))
+
+		if managerID := cell("managerId"); managerID != "" {
+			res.Manager.ID, err = strconv.ParseInt(managerID, 10, 64)
+			v.CheckCode(err == nil, "manager", validator.CodeBadFormat, "id must be a number")
+		}
+
+		var ok bool
+		res.Active, ok = parseActive(cell("active"))
+		v.CheckCode(ok, "active", validator.CodeBadFormat, "must be true or false")
+
+		if first, dup := seenIDs[res.ID]; dup && res.ID != 0 {
+			v.AddErrorCode("id", validator.CodeDuplicate, fmt.Sprintf("duplicates line %d", first))
+		} else {
+			seenIDs[res.ID] = line
+		}
+
+		email := strings.ToLower(res.Email)
+		if first, dup := seenEmails[email]; dup && email != "" {
+			v.AddErrorCode("email", validator.CodeDuplicate, fmt.Sprintf("duplicates line %d", first))
+		} else {
+			seenEmails[email] = line
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// importReadError marks malformed CSV as an invalid import, leaving errors
+// from the underlying reader, such as a body that is too large, as they are.
+func importReadError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidImport, parseErr)
+	}
+	return err
+}
+
+// ExistingIDs returns which of ids belong to resources already on file.
+func (m *ResourceModel) ExistingIDs(ids []int64) (map[int64]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT employee_id FROM resource WHERE employee_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+
+	return existing, rows.Err()
+}
+
+// Import upserts resources on employee_id in a single transaction. The rows
+// are streamed into a temporary table with COPY and merged from there, so
+// either every resource is written or none are.
+func (m *ResourceModel) Import(resources []*Resource) (created, updated int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE resource_import (LIKE resource INCLUDING DEFAULTS) ON COMMIT DROP`)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("resource_import",
+		"employee_id", "name", "email", "job_title_id", "manager_id", "workgroup_id",
+		"clearance", "specialties", "certifications", "active"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, r := range resources {
+		var clearance any
+		if r.Clearance != "" {
+			clearance = r.Clearance
+		}
+
+		_, err = stmt.ExecContext(ctx, r.ID, r.Name, r.Email, r.JobTitle.ID, r.Manager.ID, r.Workgroup.ID,
+			clearance, pq.Array(r.Specialties), pq.Array(r.Certifications), r.Active)
+		if err != nil {
+			stmt.Close()
+			return 0, 0, err
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return 0, 0, constraintError(err)
+	}
+	if err = stmt.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO resource
+		(employee_id, name, email, job_title_id, manager_id, workgroup_id, clearance, specialties, certifications, active)
+		SELECT employee_id, name, email, job_title_id, manager_id, workgroup_id, clearance, specialties, certifications, active
+		FROM resource_import
+		ON CONFLICT (employee_id) DO UPDATE
+		SET name=EXCLUDED.name, email=EXCLUDED.email, job_title_id=EXCLUDED.job_title_id,
+			manager_id=EXCLUDED.manager_id, workgroup_id=EXCLUDED.workgroup_id, clearance=EXCLUDED.clearance,
+			specialties=EXCLUDED.specialties, certifications=EXCLUDED.certifications, active=EXCLUDED.active
+		RETURNING xmax = 0`)
+	if err != nil {
+		return 0, 0, constraintError(err)
+	}
+
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		if inserted {
+			created++
+		} else {
+			updated++
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, 0, constraintError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	return created, updated, nil
+}
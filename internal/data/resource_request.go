@@ -15,11 +15,11 @@ type ResourceRequest struct {
 	ID            int64                     `json:"id"`
 	OpportunityID string                    `json:"opportunityId,omitempty"`
 	JobTitle      string                    `json:"jobTitle"`
-	TotalHours    float64                   `json:"totalHours"`
-	Skills        []string                  `json:"skills"`
+	TotalHours    float64                   `json:"totalHours" validate:"min=0"`
+	Skills        []string                  `json:"skills" validate:"required,unique"`
 	StartDate     time.Time                 `json:"startDate"`
-	HoursPerWeek  float64                   `json:"hoursPerWeek"`
-	Status        string                    `json:"status"`
+	HoursPerWeek  float64                   `json:"hoursPerWeek" validate:"min=0,max=40"`
+	Status        string                    `json:"status" validate:"required,oneof=Open|Closed"`
 	CreatedAt     time.Time                 `json:"createdAt,omitempty"`
 	UpdatedAt     time.Time                 `json:"updatedAt,omitempty"`
 	Version       int64                     `json:"version,omitempty"`
@@ -27,28 +27,13 @@ type ResourceRequest struct {
 	Assignments   []*ResourceAssignment     `json:"assignedResources,omitempty"`
 }
 
-func ValidateSkills(v *validator.Validator, skills []string) {
-	v.Check(len(skills) > 0, "skills", "at least one skill is required")
-	v.Check(validator.Unique(skills), "skills", "cannot contain duplicate values")
-}
-
 func ValidateStartDate(v *validator.Validator, startDate, proposedDate time.Time) {
 	v.Check(startDate.After(time.Now()), "startDate", fmt.Sprintf("cannot be before %s", startDate.String()))
 }
 
-func ValidateResourceRequestStatus(v *validator.Validator, status string) {
-	v.Check(status != "", "status", "must be provided")
-	statuses := []string{
-		"Open",
-		"Closed",
-	}
-	v.Check(validator.PermittedValue(status, statuses...), "status", "is not a recognised status [Open, Closed]")
-}
-
 func ValidateResourceRequest(v *validator.Validator, rr ResourceRequest) {
-	ValidateSkills(v, rr.Skills)
+	v.Struct(rr)
 	ValidateStartDate(v, time.Now(), rr.StartDate)
-	ValidateResourceRequestStatus(v, rr.Status)
 }
 
 type ResourceRequestModel struct {
@@ -78,7 +63,12 @@ func (m *ResourceRequestModel) Insert(r *ResourceRequest) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID, &r.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID, &r.Version)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
 }
 
 func (m *ResourceRequestModel) Get(id int64) (*ResourceRequest, error) {
@@ -152,7 +142,7 @@ func (m *ResourceRequestModel) Update(r *ResourceRequest) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return constraintError(err)
 		}
 	}
 
@@ -199,3 +189,17 @@ func (m *ResourceRequestModel) GetForOpportunity(oppID string) ([]*ResourceReque
 
 	return requests, nil
 }
+
+func (m *ResourceRequestModel) CountOpen() (int, error) {
+	query := `
+		SELECT count(*)
+		FROM resource_request
+		WHERE status='Open'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
@@ -6,20 +6,21 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/vmw-pso/back-end/internal/validator"
 )
 
 type ResourceRequestComment struct {
 	ID                int64     `json:"id"`
 	ResourceRequestID int64     `json:"requestID,omitempty"`
-	Comment           string    `json:"comment"`
+	Comment           string    `json:"comment" validate:"required"`
 	CreatedAt         time.Time `json:"createdAt,omitempty"`
 	UpdatedAt         time.Time `json:"updatedAt,omitempty"`
 	Version           int64     `json:"version,omitempty"`
 }
 
 func ValidateComment(v *validator.Validator, comment string) {
-	v.Check(comment != "", "comment", "must be provided")
+	v.CheckCode(comment != "", "comment", validator.CodeRequired, "must be provided")
 }
 
 type ResourceRequestCommentModel struct {
@@ -43,7 +44,12 @@ func (m *ResourceRequestCommentModel) Insert(c ResourceRequestComment) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.Version)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	return nil
 }
 
 func (m *ResourceRequestCommentModel) Get(id int64) (*ResourceRequestComment, error) {
@@ -101,7 +107,7 @@ func (m *ResourceRequestCommentModel) Update(c *ResourceRequestComment) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return constraintError(err)
 		}
 	}
 
@@ -142,3 +148,44 @@ func (m *ResourceRequestCommentModel) GetForRequest(reqId int64) ([]*ResourceReq
 
 	return comments, nil
 }
+
+func (m *ResourceRequestCommentModel) GetForRequests(reqIDs []int64) (map[int64][]*ResourceRequestComment, error) {
+	query := `
+		SELECT comment_id, request_id, comment, created_at, updated_at, version
+		FROM resource_request_comment
+		WHERE request_id = ANY($1)
+		ORDER BY created_at ASC, comment_id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(reqIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make(map[int64][]*ResourceRequestComment, len(reqIDs))
+
+	for rows.Next() {
+		var comment ResourceRequestComment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.ResourceRequestID,
+			&comment.Comment,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+			&comment.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments[comment.ResourceRequestID] = append(comments[comment.ResourceRequestID], &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,514 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+const (
+	RosterReconciliationPending   = "pending"
+	RosterReconciliationConfirmed = "confirmed"
+)
+
+// RosterReconciliationMaxAge is how long a reconciliation can be confirmed
+// for. The roster it was made from says less about who has left the longer
+// ago it was exported.
+const RosterReconciliationMaxAge = 24 * time.Hour
+
+var ErrStaleReconciliation = errors.New("reconciliation is too old to confirm")
+
+// RosterEntry is one person on an HR roster. Manager may be given by name,
+// by employee ID or both; the ID is used when it is.
+type RosterEntry struct {
+	EmployeeID int64  `json:"employeeId"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	JobTitle   string `json:"jobTitle"`
+	Manager    string `json:"manager"`
+	ManagerID  int64  `json:"managerId"`
+	Workgroup  string `json:"workgroup"`
+}
+
+type RosterPerson struct {
+	EmployeeID int64  `json:"employeeId"`
+	Name       string `json:"name"`
+	Email      string `json:"email,omitempty"`
+	Rejoining  bool   `json:"rejoining,omitempty"`
+}
+
+type RosterChange struct {
+	EmployeeID int64  `json:"employeeId"`
+	Name       string `json:"name"`
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// RosterReport is the difference between an HR roster and the resources on
+// file. Joiners include people on file who are inactive; changes are only
+// reported for people who are active on both.
+type RosterReport struct {
+	RosterSize int            `json:"rosterSize"`
+	Active     int            `json:"active"`
+	Joiners    []RosterPerson `json:"joiners"`
+	Leavers    []RosterPerson `json:"leavers"`
+	Changes    []RosterChange `json:"changes"`
+}
+
+type RosterResult struct {
+	Deactivated        int     `json:"deactivated"`
+	AssignmentsEnded   int     `json:"assignmentsEnded"`
+	AssignmentsRemoved int     `json:"assignmentsRemoved"`
+	RequestsReopened   []int64 `json:"requestsReopened"`
+}
+
+type RosterReconciliation struct {
+	ID          int64         `json:"id"`
+	Status      string        `json:"status"`
+	Report      RosterReport  `json:"report"`
+	Result      *RosterResult `json:"result,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	ConfirmedAt *time.Time    `json:"confirmedAt,omitempty"`
+}
+
+// RosterFromImport converts the rows of an HR export to roster entries,
+// copying any problems found while parsing them to v. People marked
+// inactive in the export are left off the roster.
+func RosterFromImport(v *validator.Validator, rows []*ResourceImportRow) []RosterEntry {
+	entries := make([]RosterEntry, 0, len(rows))
+
+	for i, row := range rows {
+		for _, e := range row.Validator.Errors() {
+			v.At("roster", i).AddErrorCode(e.Key(), e.Code, e.Message)
+		}
+
+		if !row.Resource.Active {
+			continue
+		}
+
+		res := row.Resource
+		entries = append(entries, RosterEntry{
+			EmployeeID: res.ID,
+			Name:       res.Name,
+			Email:      res.Email,
+			JobTitle:   res.JobTitle.Name,
+			Manager:    res.Manager.Name,
+			ManagerID:  res.Manager.ID,
+			Workgroup:  res.Workgroup.Name,
+		})
+	}
+
+	return entries
+}
+
+func ValidateRoster(v *validator.Validator, roster []RosterEntry) {
+	v.CheckCode(len(roster) > 0, "roster", validator.CodeRequired, "must contain at least one person")
+
+	seen := make(map[int64]int, len(roster))
+	for i, entry := range roster {
+		ev := v.At("roster", i)
+		ev.CheckCode(entry.EmployeeID > 0, "employeeId", validator.CodeRequired, "must be provided")
+		ev.CheckCode(strings.TrimSpace(entry.Name) != "", "name", validator.CodeRequired, "must be provided")
+		ev.CheckCode(entry.ManagerID >= 0, "managerId", validator.CodeOutOfRange, "must be a positive integer")
+
+		if first, dup := seen[entry.EmployeeID]; dup && entry.EmployeeID > 0 {
+			ev.AddErrorCode("employeeId", validator.CodeDuplicate, fmt.Sprintf("duplicates roster entry %d", first))
+		} else {
+			seen[entry.EmployeeID] = i
+		}
+	}
+}
+
+// ReconcileRoster compares roster with the resources currently on file.
+// Titles, workgroups and manager names are compared without regard to case
+// or surrounding space, and fields the roster leaves blank are not compared.
+func ReconcileRoster(current []*Resource, roster []RosterEntry) *RosterReport {
+	report := &RosterReport{
+		RosterSize: len(roster),
+		Joiners:    []RosterPerson{},
+		Leavers:    []RosterPerson{},
+		Changes:    []RosterChange{},
+	}
+
+	byID := make(map[int64]*Resource, len(current))
+	for _, r := range current {
+		byID[r.ID] = r
+		if r.Active {
+			report.Active++
+		}
+	}
+
+	same := func(a, b string) bool {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+
+	onRoster := make(map[int64]bool, len(roster))
+	for _, entry := range roster {
+		onRoster[entry.EmployeeID] = true
+
+		r, ok := byID[entry.EmployeeID]
+		if !ok || !r.Active {
+			report.Joiners = append(report.Joiners, RosterPerson{
+				EmployeeID: entry.EmployeeID,
+				Name:       entry.Name,
+				Email:      entry.Email,
+				Rejoining:  ok,
+			})
+			continue
+		}
+
+		change := func(field, from, to string) {
+			report.Changes = append(report.Changes, RosterChange{
+				EmployeeID: r.ID,
+				Name:       r.Name,
+				Field:      field,
+				From:       from,
+				To:         to,
+			})
+		}
+
+		if entry.JobTitle != "" && !same(entry.JobTitle, r.JobTitle.Name) {
+			change("jobTitle", r.JobTitle.Name, entry.JobTitle)
+		}
+
+		if entry.Workgroup != "" && !same(entry.Workgroup, r.Workgroup.Name) {
+			change("workgroup", r.Workgroup.Name, entry.Workgroup)
+		}
+
+		switch {
+		case entry.ManagerID != 0 && entry.ManagerID != r.Manager.ID:
+			to := entry.Manager
+			if to == "" {
+				to = strconv.FormatInt(entry.ManagerID, 10)
+			}
+			change("manager", r.Manager.Name, to)
+		case entry.ManagerID == 0 && entry.Manager != "" && !same(entry.Manager, r.Manager.Name):
+			change("manager", r.Manager.Name, entry.Manager)
+		}
+	}
+
+	for _, r := range current {
+		if r.Active && !onRoster[r.ID] {
+			report.Leavers = append(report.Leavers, RosterPerson{EmployeeID: r.ID, Name: r.Name, Email: r.Email})
+		}
+	}
+
+	sort.Slice(report.Joiners, func(i, j int) bool { return report.Joiners[i].EmployeeID < report.Joiners[j].EmployeeID })
+	sort.Slice(report.Leavers, func(i, j int) bool { return report.Leavers[i].EmployeeID < report.Leavers[j].EmployeeID })
+	sort.SliceStable(report.Changes, func(i, j int) bool { return report.Changes[i].EmployeeID < report.Changes[j].EmployeeID })
+
+	return report
+}
+
+type RosterModel struct {
+	DB *sql.DB
+}
+
+// Current returns every resource on file, active or not, with the names of
+// their job title, manager and workgroup.
+func (m *RosterModel) Current() ([]*Resource, error) {
+	query := `
+		SELECT r.employee_id, r.name, r.email, job_title.title_id, job_title.title, m.employee_id, m.name,
+			workgroup.workgroup_id, workgroup.workgroup_name, r.active IS NOT FALSE
+		FROM (((resource r
+			INNER JOIN job_title ON r.job_title_id=job_title.title_id)
+			INNER JOIN resource m ON r.manager_id=m.employee_id)
+			INNER JOIN workgroup ON workgroup.workgroup_id=r.workgroup_id)
+		ORDER BY r.employee_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []*Resource{}
+
+	for rows.Next() {
+		var r Resource
+
+		err := rows.Scan(
+			&r.ID,
+			&r.Name,
+			&r.Email,
+			&r.JobTitle.ID,
+			&r.JobTitle.Name,
+			&r.Manager.ID,
+			&r.Manager.Name,
+			&r.Workgroup.ID,
+			&r.Workgroup.Name,
+			&r.Active,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, &r)
+	}
+
+	return resources, rows.Err()
+}
+
+func (m *RosterModel) Insert(report *RosterReport) (*RosterReconciliation, error) {
+	js, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO roster_reconciliation (report)
+		VALUES ($1)
+		RETURNING reconciliation_id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rec := &RosterReconciliation{Report: *report}
+
+	err = m.DB.QueryRowContext(ctx, query, string(js)).Scan(&rec.ID, &rec.Status, &rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (m *RosterModel) Get(id int64) (*RosterReconciliation, error) {
+	query := `
+		SELECT reconciliation_id, status, report, result, created_at, confirmed_at
+		FROM roster_reconciliation
+		WHERE reconciliation_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		rec    RosterReconciliation
+		report []byte
+		result []byte
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&rec.ID, &rec.Status, &report, &result, &rec.CreatedAt, &rec.ConfirmedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(report, &rec.Report); err != nil {
+		return nil, err
+	}
+
+	if result != nil {
+		rec.Result = &RosterResult{}
+		if err := json.Unmarshal(result, rec.Result); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rec, nil
+}
+
+// Confirm applies a pending reconciliation in a single transaction. Its
+// leavers are made inactive, their assignments that have not started are
+// removed and those under way end today, and each request they were
+// assigned to is reopened with a comment saying why. Joiners and changes
+// are left for an import to apply. Leavers who have been made inactive
+// since the report are skipped, and the rest are locked until the
+// transaction ends. ErrEditConflict is returned if the reconciliation has
+// already been confirmed, and ErrStaleReconciliation if it is older than
+// RosterReconciliationMaxAge.
+func (m *RosterModel) Confirm(id int64) (*RosterReconciliation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		status string
+		stale  bool
+		js     []byte
+		report RosterReport
+	)
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, created_at < now() - make_interval(secs => $2), report
+		FROM roster_reconciliation
+		WHERE reconciliation_id=$1
+		FOR UPDATE`, id, RosterReconciliationMaxAge.Seconds()).Scan(&status, &stale, &js)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if status != RosterReconciliationPending {
+		return nil, ErrEditConflict
+	}
+
+	if stale {
+		return nil, ErrStaleReconciliation
+	}
+
+	if err := json.Unmarshal(js, &report); err != nil {
+		return nil, err
+	}
+
+	reported := make([]int64, len(report.Leavers))
+	names := make(map[int64]string, len(report.Leavers))
+	for i, leaver := range report.Leavers {
+		reported[i] = leaver.EmployeeID
+		names[leaver.EmployeeID] = leaver.Name
+	}
+
+	// Only leavers who are still active are acted on, so that nobody's
+	// assignments are ended for a departure that has already been dealt
+	// with since the report was made.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT employee_id
+		FROM resource
+		WHERE employee_id = ANY($1) AND active IS NOT FALSE
+		ORDER BY employee_id
+		FOR UPDATE`, pq.Array(reported))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int64{}
+	for rows.Next() {
+		var employeeID int64
+		if err := rows.Scan(&employeeID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, employeeID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := RosterResult{RequestsReopened: []int64{}}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE resource SET active=false
+		WHERE employee_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	result.Deactivated = len(ids)
+
+	affected := make(map[int64][]int64)
+
+	collect := func(query string, count *int) error {
+		rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var requestID, employeeID int64
+			if err := rows.Scan(&requestID, &employeeID); err != nil {
+				return err
+			}
+			if !validator.PermittedValue(employeeID, affected[requestID]...) {
+				affected[requestID] = append(affected[requestID], employeeID)
+			}
+			*count++
+		}
+
+		return rows.Err()
+	}
+
+	err = collect(`
+		DELETE FROM resource_assignment
+		WHERE employee_id = ANY($1) AND start_date > current_date
+		RETURNING resource_request_id, employee_id`, &result.AssignmentsRemoved)
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect(`
+		UPDATE resource_assignment SET end_date=current_date
+		WHERE employee_id = ANY($1) AND start_date <= current_date
+			AND (end_date IS NULL OR end_date > current_date)
+		RETURNING resource_request_id, employee_id`, &result.AssignmentsEnded)
+	if err != nil {
+		return nil, err
+	}
+
+	for requestID := range affected {
+		result.RequestsReopened = append(result.RequestsReopened, requestID)
+	}
+	sort.Slice(result.RequestsReopened, func(i, j int) bool { return result.RequestsReopened[i] < result.RequestsReopened[j] })
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE resource_request SET status='Open', updated_at=current_timestamp, version=version+1
+		WHERE request_id = ANY($1)`, pq.Array(result.RequestsReopened))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, requestID := range result.RequestsReopened {
+		people := make([]string, len(affected[requestID]))
+		for i, employeeID := range affected[requestID] {
+			people[i] = fmt.Sprintf("%s (%d)", names[employeeID], employeeID)
+		}
+
+		comment := fmt.Sprintf("Reopened automatically: %s left the company according to HR roster reconciliation %d, and their assignment was ended.",
+			strings.Join(people, ", "), id)
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO resource_request_comment (request_id, comment)
+			VALUES ($1, $2)`, requestID, comment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	js, err = json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &RosterReconciliation{ID: id, Report: report, Result: &result}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE roster_reconciliation SET status=$2, result=$3, confirmed_at=now()
+		WHERE reconciliation_id=$1
+		RETURNING status, created_at, confirmed_at`, id, RosterReconciliationConfirmed, string(js)).Scan(
+		&rec.Status, &rec.CreatedAt, &rec.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
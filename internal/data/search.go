@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+var SearchTypes = []string{"project", "resource", "request", "comment"}
+
+// SearchHit is one search result. Title is plain text. Snippet is HTML: the
+// matched text is escaped and matches are wrapped in <mark> elements, so it
+// can be rendered as HTML as it is.
+type SearchHit struct {
+	Type    string  `json:"type"`
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+func ValidateSearch(v *validator.Validator, q string, types []string, limit int) {
+	v.CheckCode(q != "", "q", validator.CodeRequired, "must be provided")
+	v.CheckCode(len(q) <= 256, "q", validator.CodeTooLong, "cannot be more than 256 bytes")
+	v.CheckCode(limit > 0, "limit", validator.CodeOutOfRange, "must be a positive integer")
+	v.CheckCode(limit <= 100, "limit", validator.CodeOutOfRange, "must be a maximum of 100")
+	for _, t := range types {
+		v.CheckCode(validator.PermittedValue(t, SearchTypes...), "types", validator.CodeNotPermitted, "must be a comma separated list of [project, resource, request, comment]")
+	}
+}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// Search ranks projects, resources, requests and comments matching q. The
+// text is HTML escaped before ts_headline marks the matches in it, as the
+// snippet is HTML and the text is user data.
+func (m *SearchModel) Search(q string, types []string, limit int) ([]*SearchHit, error) {
+	query := `
+		WITH query AS (SELECT websearch_to_tsquery('english', $1) AS tsq)
+		SELECT type, id, title, snippet, rank FROM (
+			SELECT 'project' AS type, p.opportunity_id AS id, p.name AS title,
+				ts_headline('english', html_escape(concat_ws(' - ', p.name, p.customer, p.end_customer)), query.tsq, $4) AS snippet,
+				ts_rank(p.search, query.tsq) AS rank
+			FROM project p, query
+			WHERE p.search @@ query.tsq AND 'project' = ANY($2)
+			UNION ALL
+			SELECT 'resource', r.employee_id::text, r.name,
+				ts_headline('english', html_escape(concat_ws(' - ', r.name, immutable_array_to_string(r.specialties), immutable_array_to_string(r.certifications))), query.tsq, $4),
+				ts_rank(r.search, query.tsq)
+			FROM resource r, query
+			WHERE r.search @@ query.tsq AND 'resource' = ANY($2)
+			UNION ALL
+			SELECT 'request', rr.request_id::text, rr.opportunity_id,
+				ts_headline('english', html_escape(immutable_array_to_string(rr.skills)), query.tsq, $4),
+				ts_rank(rr.search, query.tsq)
+			FROM resource_request rr, query
+			WHERE rr.search @@ query.tsq AND 'request' = ANY($2)
+			UNION ALL
+			SELECT 'comment', c.comment_id::text, c.request_id::text,
+				ts_headline('english', html_escape(c.comment), query.tsq, $4),
+				ts_rank(c.search, query.tsq)
+			FROM resource_request_comment c, query
+			WHERE c.search @@ query.tsq AND 'comment' = ANY($2)
+		) hits
+		ORDER BY rank DESC, type ASC, id ASC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if len(types) == 0 {
+		types = SearchTypes
+	}
+
+	args := []interface{}{
+		q,
+		pq.Array(types),
+		limit,
+		"StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5",
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []*SearchHit{}
+
+	for rows.Next() {
+		var hit SearchHit
+		err := rows.Scan(
+			&hit.Type,
+			&hit.ID,
+			&hit.Title,
+			&hit.Snippet,
+			&hit.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, &hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SystemModel struct {
+	DB *sql.DB
+}
+
+func (m *SystemModel) Ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return m.DB.PingContext(ctx)
+}
+
+// MigrationVersion returns the version recorded by the migrate tool in
+// schema_migrations, and whether the last migration failed part way.
+func (m *SystemModel) MigrationVersion() (int, bool, error) {
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var version int
+	var dirty bool
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,564 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vmw-pso/back-end/internal/validator"
+)
+
+// WebhookEventTypes are the events a webhook can subscribe to. They are
+// recorded by database triggers in the same transaction as the change, so
+// an event is only ever sent for a change that was committed. A
+// subscription to "*" receives every event.
+var WebhookEventTypes = []string{
+	"*",
+	"project.created", "project.updated", "project.deleted",
+	"resource.created", "resource.updated", "resource.deleted",
+	"request.created", "request.updated", "request.deleted",
+	"comment.created", "comment.updated", "comment.deleted",
+	"assignment.created", "assignment.updated", "assignment.deleted",
+}
+
+// webhookDeliveryAttempts gives a failing endpoint about an hour and a half,
+// with the job queue's backoff, to recover before a delivery is dead.
+const webhookDeliveryAttempts = 10
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+var WebhookDeliveryStatuses = []string{WebhookDeliveryPending, WebhookDeliverySucceeded, WebhookDeliveryFailed}
+
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Version    int       `json:"version"`
+}
+
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// WebhookDelivery is the log of sending one event to one webhook. Retries
+// update the same delivery; a replay creates a new one.
+type WebhookDelivery struct {
+	ID             int64         `json:"id"`
+	WebhookID      int64         `json:"webhookID"`
+	Event          *WebhookEvent `json:"event"`
+	Status         string        `json:"status"`
+	Attempts       int           `json:"attempts"`
+	ResponseStatus int           `json:"responseStatus,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	DurationMS     int           `json:"durationMs,omitempty"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	AttemptedAt    *time.Time    `json:"attemptedAt,omitempty"`
+}
+
+// WebhookAttempt is the outcome of one attempt to deliver an event.
+type WebhookAttempt struct {
+	ResponseStatus int
+	Err            error
+	Duration       time.Duration
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not covered
+// by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicAddr reports whether addr is a public unicast address. Webhooks
+// may only be delivered to public addresses, so that they cannot be used to
+// reach internal services or cloud metadata endpoints.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// ValidateWebhook checks a webhook's settings. Unless allowPrivate is set,
+// which is only meant for development, the URL must use https and must not
+// name a private or loopback address. Host names are checked again when
+// each delivery connects, as they may resolve to anything.
+func ValidateWebhook(v *validator.Validator, webhook *Webhook, allowPrivate bool) {
+	v.CheckCode(webhook.URL != "", "url", validator.CodeRequired, "must be provided")
+	v.CheckCode(validator.MaxLength(webhook.URL, 2048), "url", validator.CodeTooLong, "must not be more than 2048 bytes long")
+
+	if webhook.URL != "" {
+		u, err := url.Parse(webhook.URL)
+		ok := err == nil && u.Host != "" && (u.Scheme == "https" || u.Scheme == "http")
+		v.CheckCode(ok, "url", validator.CodeBadFormat, "must be an absolute http or https URL")
+
+		if ok && !allowPrivate {
+			v.CheckCode(u.Scheme == "https", "url", validator.CodeNotPermitted, "must use https")
+
+			host := u.Hostname()
+			addr, err := netip.ParseAddr(host)
+			public := !strings.EqualFold(host, "localhost") && !strings.HasSuffix(strings.ToLower(host), ".localhost") &&
+				(err != nil || IsPublicAddr(addr))
+			v.CheckCode(public, "url", validator.CodeNotPermitted, "must not be a private or local address")
+		}
+	}
+
+	v.CheckCode(validator.MinLength(webhook.Secret, 16), "secret", validator.CodeTooShort, "must be at least 16 bytes long")
+	v.CheckCode(validator.MaxLength(webhook.Secret, 256), "secret", validator.CodeTooLong, "must not be more than 256 bytes long")
+
+	v.CheckCode(len(webhook.EventTypes) > 0, "eventTypes", validator.CodeRequired, "must contain at least one event type")
+	v.CheckCode(validator.Unique(webhook.EventTypes), "eventTypes", validator.CodeDuplicate, "must not contain duplicate values")
+	for i, eventType := range webhook.EventTypes {
+		v.At("eventTypes", i).CheckCode(validator.PermittedValue(eventType, WebhookEventTypes...), "",
+			validator.CodeNotPermitted, "is not a webhook event type")
+	}
+}
+
+func ValidateWebhookDeliveryStatus(v *validator.Validator, status string) {
+	if status != "" {
+		v.CheckCode(validator.PermittedValue(status, WebhookDeliveryStatuses...), "status", validator.CodeNotPermitted, "invalid status value")
+	}
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+func (m *WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhook (url, secret, event_types, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	args := []any{webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes), webhook.Active}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt, &webhook.Version)
+}
+
+func (m *WebhookModel) Get(id int64) (*Webhook, error) {
+	query := `
+		SELECT webhook_id, url, secret, event_types, active, created_at, updated_at, version
+		FROM webhook
+		WHERE webhook_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.EventTypes),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (m *WebhookModel) GetAll(filters Filters) ([]*Webhook, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), webhook_id, url, secret, event_types, active, created_at, updated_at, version
+		FROM webhook
+		ORDER BY %s %s, webhook_id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&totalRecords,
+			&webhook.ID,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.EventTypes),
+			&webhook.Active,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return webhooks, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhook
+		SET url=$1, secret=$2, event_types=$3, active=$4, updated_at=now(), version=version+1
+		WHERE webhook_id=$5 AND version=$6
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	args := []any{
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.EventTypes),
+		webhook.Active,
+		webhook.ID,
+		webhook.Version,
+	}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.UpdatedAt, &webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the webhook and its delivery log. Deliveries that are
+// still queued are dropped when their job finds the webhook gone.
+func (m *WebhookModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM webhook WHERE webhook_id=$1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Dispatch creates a delivery, and queues a job to send it, for each active
+// webhook subscribed to each of up to limit pending events. It returns the
+// number of events processed.
+func (m *WebhookModel) Dispatch(limit int, deliverJobKind string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT event_id, event_type
+		FROM webhook_event
+		WHERE dispatched_at IS NULL
+		ORDER BY event_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []WebhookEvent
+	for rows.Next() {
+		var e WebhookEvent
+		if err := rows.Scan(&e.ID, &e.Type); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		rows, err := tx.QueryContext(ctx, `
+			INSERT INTO webhook_delivery (webhook_id, event_id)
+			SELECT webhook_id, $1
+			FROM webhook
+			WHERE active AND ($2=ANY(event_types) OR '*'=ANY(event_types))
+			RETURNING delivery_id`, e.ID, e.Type)
+		if err != nil {
+			return 0, err
+		}
+
+		var deliveries []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			deliveries = append(deliveries, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, id := range deliveries {
+			if err := queueDelivery(tx, id, deliverJobKind); err != nil {
+				return 0, err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_event SET dispatched_at=now() WHERE event_id=$1`, e.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), tx.Commit()
+}
+
+func queueDelivery(tx *sql.Tx, deliveryID int64, jobKind string) error {
+	payload, _ := json.Marshal(map[string]int64{"id": deliveryID})
+	job := &Job{Kind: jobKind, Payload: payload, MaxAttempts: webhookDeliveryAttempts}
+	return (&JobModel{}).insert(tx, job)
+}
+
+// Replay sends the event from an earlier delivery to its webhook again, as
+// a new delivery with its own log and retries.
+func (m *WebhookModel) Replay(webhookID, deliveryID int64, deliverJobKind string) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_delivery (webhook_id, event_id)
+		SELECT webhook_id, event_id
+		FROM webhook_delivery
+		WHERE delivery_id=$1 AND webhook_id=$2
+		RETURNING delivery_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, query, deliveryID, webhookID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := queueDelivery(tx, id, deliverJobKind); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m.GetDelivery(id)
+}
+
+const webhookDeliveryColumns = `
+	d.delivery_id, d.webhook_id, e.event_id, e.event_type, e.payload, e.created_at, d.status, d.attempts,
+	COALESCE(d.response_status, 0), COALESCE(d.error, ''),
+	COALESCE(d.duration_ms, 0), d.created_at, d.attempted_at`
+
+func scanWebhookDelivery(scan func(dest ...any) error, extra ...any) (*WebhookDelivery, error) {
+	d := WebhookDelivery{Event: &WebhookEvent{}}
+
+	dest := append(extra,
+		&d.ID,
+		&d.WebhookID,
+		&d.Event.ID,
+		&d.Event.Type,
+		&d.Event.Payload,
+		&d.Event.CreatedAt,
+		&d.Status,
+		&d.Attempts,
+		&d.ResponseStatus,
+		&d.Error,
+		&d.DurationMS,
+		&d.CreatedAt,
+		&d.AttemptedAt,
+	)
+
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (m *WebhookModel) GetDelivery(id int64) (*WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_delivery d
+			INNER JOIN webhook_event e ON e.event_id=d.event_id
+		WHERE d.delivery_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d, err := scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// GetDeliveries returns the delivery log for a webhook, optionally limited
+// to deliveries with status.
+func (m *WebhookModel) GetDeliveries(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+webhookDeliveryColumns+`
+		FROM webhook_delivery d
+			INNER JOIN webhook_event e ON e.event_id=d.event_id
+		WHERE d.webhook_id=$1
+		AND (d.status=$2 OR $2='')
+		ORDER BY d.%s %s, d.delivery_id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows.Scan, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return deliveries, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// RecordAttempt stores the outcome of an attempt in the delivery log.
+func (m *WebhookModel) RecordAttempt(id int64, attempt WebhookAttempt) error {
+	query := `
+		UPDATE webhook_delivery
+		SET status=$2, attempts=attempts+1, response_status=NULLIF($3, 0), error=NULLIF($4, ''),
+			duration_ms=$5, attempted_at=now()
+		WHERE delivery_id=$1`
+
+	status, errMsg := WebhookDeliverySucceeded, ""
+	if attempt.Err != nil {
+		status, errMsg = WebhookDeliveryFailed, attempt.Err.Error()
+	}
+
+	args := []any{id, status, attempt.ResponseStatus, errMsg, attempt.Duration.Milliseconds()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteBefore removes deliveries created before cutoff, and then the
+// dispatched events recorded before cutoff that have no deliveries left.
+func (m *WebhookModel) DeleteBefore(cutoff time.Time) (deliveries, events int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM webhook_delivery
+		WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	deliveries, err = result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		DELETE FROM webhook_event e
+		WHERE e.dispatched_at < $1
+		AND NOT EXISTS (SELECT 1 FROM webhook_delivery d WHERE d.event_id=e.event_id)`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	events, err = result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return deliveries, events, tx.Commit()
+}
@@ -2,16 +2,21 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -19,8 +24,12 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
@@ -30,50 +39,133 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel returns the level named by s, e.g. "info" or "ERROR".
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l < LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(s, "off") {
+		return LevelOff, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// sink is the state shared by a logger and all of its children.
+type sink struct {
+	out        io.Writer
+	mu         sync.Mutex
+	minLevel   atomic.Int32
+	traceLevel atomic.Int32
+	redactor   atomic.Pointer[Redactor]
+}
+
+// Logger writes one JSON object per line. Properties may be of any type
+// that encoding/json can marshal; error values are written as their message.
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	*sink
+	fields map[string]any
 }
 
+// New returns a logger that writes entries at minLevel and above to out.
+// Stack traces are only attached to FATAL entries; see SetTraceLevel.
+// Entries are redacted with DefaultRedactionRules; see SetRedactor.
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+	l := &Logger{sink: &sink{out: out}}
+	l.minLevel.Store(int32(minLevel))
+	l.traceLevel.Store(int32(LevelFatal))
+
+	redactor, _ := NewRedactor(DefaultRedactionRules)
+	l.redactor.Store(redactor)
+
+	return l
+}
+
+// With returns a child logger that adds properties to every entry. The
+// child shares its output and levels with l.
+func (l *Logger) With(properties map[string]any) *Logger {
+	fields := make(map[string]any, len(l.fields)+len(properties))
+	for k, v := range l.fields {
+		fields[k] = v
 	}
+	for k, v := range properties {
+		fields[k] = v
+	}
+	return &Logger{sink: l.sink, fields: fields}
+}
+
+// SetLevel changes the minimum level written by the logger and its children.
+func (l *Logger) SetLevel(level Level) {
+	l.minLevel.Store(int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
+}
+
+// SetRedactor replaces the redactor applied to messages and properties.
+// A nil redactor disables redaction.
+func (l *Logger) SetRedactor(r *Redactor) {
+	l.redactor.Store(r)
+}
+
+// SetTraceLevel sets the level from which entries include a stack trace.
+// Use LevelOff to disable stack traces altogether.
+func (l *Logger) SetTraceLevel(level Level) {
+	l.traceLevel.Store(int32(level))
 }
 
-func (l *Logger) PrintInfo(message string, properties map[string]string) {
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) PrintDebug(message string, properties map[string]any) {
+	l.print(LevelDebug, message, properties)
+}
+
+func (l *Logger) PrintInfo(message string, properties map[string]any) {
 	l.print(LevelInfo, message, properties)
 }
 
-func (l *Logger) PrintError(err error, properties map[string]string) {
+func (l *Logger) PrintWarn(message string, properties map[string]any) {
+	l.print(LevelWarn, message, properties)
+}
+
+func (l *Logger) PrintError(err error, properties map[string]any) {
 	l.print(LevelError, err.Error(), properties)
 }
 
-func (l *Logger) PrintFatal(err error, properties map[string]string) {
+func (l *Logger) PrintFatal(err error, properties map[string]any) {
 	l.print(LevelFatal, err.Error(), properties)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+func (l *Logger) print(level Level, message string, properties map[string]any) (int, error) {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
 
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
-		Properties: properties,
+		Properties: l.properties(properties),
+	}
+
+	if r := l.redactor.Load(); r != nil {
+		aux.Message = r.String(aux.Message)
+		for k, v := range aux.Properties {
+			aux.Properties[k] = r.Value(k, v)
+		}
 	}
 
-	if level >= LevelError {
+	if level >= Level(l.traceLevel.Load()) {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -89,6 +181,37 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 	return l.out.Write(append(line, '\n'))
 }
 
+// properties merges the logger's bound fields with those of a single entry.
+func (l *Logger) properties(properties map[string]any) map[string]any {
+	if len(l.fields) == 0 && len(properties) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]any, len(l.fields)+len(properties))
+	for k, v := range l.fields {
+		merged[k] = jsonValue(v)
+	}
+	for k, v := range properties {
+		merged[k] = jsonValue(v)
+	}
+	return merged
+}
+
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
 func (l *Logger) Write(message []byte) (n int, err error) {
 	return l.print(LevelError, string(message), nil)
 }
@@ -0,0 +1,198 @@
+package jsonlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces sensitive values in log entries.
+const Redacted = "[REDACTED]"
+
+// RedactionRules configure a Redactor.
+type RedactionRules struct {
+	// Fields are property keys, and key=value pairs in text such as URL
+	// query strings, whose values are always redacted. A field of the form
+	// path?param only redacts that query parameter in URLs for that path.
+	// Matching ignores case.
+	Fields []string
+	// Patterns are regular expressions redacted wherever they appear in
+	// messages and string properties. If a pattern has a capture group only
+	// the first group is redacted.
+	Patterns []string
+}
+
+// DefaultRedactionRules cover the personal data handled by the API: email
+// addresses, employee IDs and security clearances anywhere, and the names,
+// managers and free-text searches in resource queries. Clearance values are
+// only matched where they are named as a clearance, in Postgres enum errors
+// and filter expressions, as the bare values are common words.
+var DefaultRedactionRules = RedactionRules{
+	Fields: []string{
+		"email", "employee_id", "clearance", "password", "secret", "token",
+		"/v1/resources?name", "/v1/resources?manager", "/v1/resources?filter",
+		"/v1/resources/autocomplete?q", "/v1/search?q",
+	},
+	Patterns: []string{
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		`/resources/(\d+)`,
+		`\bKey \([^)]*\)=\(([^)]*)\)`,
+		`\benum clearance: "([^"]*)"`,
+		`(?i)\bclearance\s*(?:!?=|in\b)\s*(\([^)]*\)|"[^"]*"|[^\s&)]+)`,
+		`(?i)clearance(?:\+|%20)*(?:(?:%21)?%3D|in\b)(?:\+|%20)*(%28.*?%29|%22.*?%22|[^\s&+%]+)`,
+	},
+}
+
+// urlQuery matches a URL path and its query string.
+var urlQuery = regexp.MustCompile(`(/[^\s?"]*)\?([^\s#"]*)`)
+
+// Redactor removes sensitive values from messages and properties before
+// they are written.
+type Redactor struct {
+	fields   map[string]bool
+	params   map[string]map[string]bool
+	pairs    *regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+func NewRedactor(rules ...RedactionRules) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]bool), params: make(map[string]map[string]bool)}
+
+	var names []string
+	for _, rule := range rules {
+		for _, field := range rule.Fields {
+			field = strings.ToLower(field)
+
+			if path, param, ok := strings.Cut(field, "?"); ok {
+				if r.params[path] == nil {
+					r.params[path] = make(map[string]bool)
+				}
+				r.params[path][param] = true
+				continue
+			}
+
+			if !r.fields[field] {
+				r.fields[field] = true
+				names = append(names, regexp.QuoteMeta(field))
+			}
+		}
+
+		for _, pattern := range rule.Patterns {
+			rx, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+			}
+			r.patterns = append(r.patterns, rx)
+		}
+	}
+
+	if len(names) > 0 {
+		r.pairs = regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)=([^&\s]*)`)
+	}
+
+	return r, nil
+}
+
+// String redacts key=value pairs for sensitive fields, query parameters
+// sensitive for their path and any text matching the redaction patterns.
+func (r *Redactor) String(s string) string {
+	if len(r.params) > 0 {
+		s = urlQuery.ReplaceAllStringFunc(s, r.redactQuery)
+	}
+	if r.pairs != nil {
+		s = redactMatches(r.pairs, s)
+	}
+	for _, rx := range r.patterns {
+		s = redactMatches(rx, s)
+	}
+	return s
+}
+
+// Value redacts a property value. Values of sensitive fields are replaced
+// entirely; strings are redacted with String, and maps and slices are
+// redacted element by element.
+func (r *Redactor) Value(key string, v any) any {
+	if r.fields[strings.ToLower(key)] && v != nil && v != "" {
+		return Redacted
+	}
+
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case error:
+		return r.String(v.Error())
+	case fmt.Stringer:
+		return r.String(v.String())
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = r.Value(k, e)
+		}
+		return m
+	case map[string]string:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = r.Value(k, e)
+		}
+		return m
+	case []string:
+		s := make([]string, len(v))
+		for i, e := range v {
+			s[i] = r.String(e)
+		}
+		return s
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = r.Value("", e)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// redactQuery redacts the parameters of a path?query match that are
+// sensitive for that path.
+func (r *Redactor) redactQuery(s string) string {
+	path, query, _ := strings.Cut(s, "?")
+
+	params := r.params[strings.ToLower(path)]
+	if params == nil {
+		return s
+	}
+
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok && value != "" && params[strings.ToLower(key)] {
+			pairs[i] = key + "=" + Redacted
+		}
+	}
+
+	return path + "?" + strings.Join(pairs, "&")
+}
+
+func redactMatches(rx *regexp.Regexp, s string) string {
+	if rx.NumSubexp() == 0 {
+		return rx.ReplaceAllLiteralString(s, Redacted)
+	}
+
+	matches := rx.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[2] < 0 {
+			continue
+		}
+		sb.WriteString(s[last:m[2]])
+		sb.WriteString(Redacted)
+		last = m[3]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package jsonlog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newDefaultRedactor(t *testing.T) *Redactor {
+	t.Helper()
+
+	r, err := NewRedactor(DefaultRedactionRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRedactorString(t *testing.T) {
+	r := newDefaultRedactor(t)
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"nothing to see", "nothing to see"},
+		{"mail jo.smith@example.com now", "mail [REDACTED] now"},
+		{"GET /v1/resources/1234", "GET /v1/resources/[REDACTED]"},
+		{"PATCH /v1/resource-certifications/1234", "PATCH /v1/resource-certifications/1234"},
+		{
+			`pq: duplicate key value violates unique constraint "resource_email_key" Key (email)=(jo@x.io) already exists`,
+			`pq: duplicate key value violates unique constraint "resource_email_key" Key (email)=([REDACTED]) already exists`,
+		},
+		{"token=abc123&page=2", "token=[REDACTED]&page=2"},
+		{"PASSWORD=hunter2 user=pso", "PASSWORD=[REDACTED] user=pso"},
+		{"/v1/resources?name=Jo&page=2", "/v1/resources?name=[REDACTED]&page=2"},
+		{"/v1/resources?manager=Sam&sort=name", "/v1/resources?manager=[REDACTED]&sort=name"},
+		{"/v1/resources?filter=active%20%3D%20true", "/v1/resources?filter=[REDACTED]"},
+		{"/v1/resources/autocomplete?q=jo", "/v1/resources/autocomplete?q=[REDACTED]"},
+		{"/v1/search?q=vsan&types=resource", "/v1/search?q=[REDACTED]&types=resource"},
+		{"/v1/projects?name=Apollo", "/v1/projects?name=Apollo"},
+		{"/v1/projects?q=x&name=Apollo", "/v1/projects?q=x&name=Apollo"},
+		{"/v1/resources?clearance=NV1", "/v1/resources?clearance=[REDACTED]"},
+		{"/v1/projects?clearance=NV2&page=1", "/v1/projects?clearance=[REDACTED]&page=1"},
+		{`pq: invalid input value for enum clearance: "Secret"`, `pq: invalid input value for enum clearance: "[REDACTED]"`},
+		{`pq: invalid input value for enum revenue_type: "Other"`, `pq: invalid input value for enum revenue_type: "Other"`},
+		{"clearance = NV1 and active = true", "clearance = [REDACTED] and active = true"},
+		{`Clearance != "TSPV"`, `Clearance != [REDACTED]`},
+		{"(clearance in (NV1, NV2))", "(clearance in [REDACTED])"},
+		{"/v1/projects?filter=clearance%20%3D%20NV1&page=1", "/v1/projects?filter=clearance%20%3D%20[REDACTED]&page=1"},
+		{"/v1/projects?filter=clearance+in+%28NV1%2C+NV2%29", "/v1/projects?filter=clearance+in+[REDACTED]"},
+		{"Baseline metrics for NV1 hosts", "Baseline metrics for NV1 hosts"},
+		{"clearance checks passed", "clearance checks passed"},
+	}
+
+	for _, tt := range tests {
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorValue(t *testing.T) {
+	r := newDefaultRedactor(t)
+
+	tests := []struct {
+		key  string
+		in   any
+		want any
+	}{
+		{"email", "jo@example.com", Redacted},
+		{"Email", "jo@example.com", Redacted},
+		{"employee_id", int64(1234), Redacted},
+		{"clearance", "NV1", Redacted},
+		{"clearance", "", ""},
+		{"clearance", nil, nil},
+		{"name", "Jo Smith", "Jo Smith"},
+		{"count", 3, 3},
+		{"note", "sent to jo@example.com", "sent to [REDACTED]"},
+		{"error", errors.New(`enum clearance: "NV2"`), `enum clearance: "[REDACTED]"`},
+		{
+			"properties",
+			map[string]any{"clearance": "NV2", "rows": 2, "detail": map[string]string{"email": "jo@x.io"}},
+			map[string]any{"clearance": Redacted, "rows": 2, "detail": map[string]any{"email": Redacted}},
+		},
+		{"recipients", []string{"jo@x.io", "team"}, []string{"[REDACTED]", "team"}},
+		{"changes", []any{map[string]any{"clearance": "TSPV"}, "ok"}, []any{map[string]any{"clearance": Redacted}, "ok"}},
+	}
+
+	for _, tt := range tests {
+		if got := r.Value(tt.key, tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Value(%q, %#v) = %#v, want %#v", tt.key, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorExtraRules(t *testing.T) {
+	r, err := NewRedactor(DefaultRedactionRules, RedactionRules{
+		Fields:   []string{"api_key", "/v1/projects?name"},
+		Patterns: []string{`ticket-(\d+)`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"api_key=xyz", "api_key=[REDACTED]"},
+		{"/v1/projects?name=Apollo", "/v1/projects?name=[REDACTED]"},
+		{"see ticket-42", "see ticket-[REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := NewRedactor(RedactionRules{Patterns: []string{"("}}); err == nil {
+		t.Error("NewRedactor with an invalid pattern returned no error")
+	}
+}
@@ -0,0 +1,102 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler returns a slog.Handler that writes through l, so that packages
+// logging with log/slog share its output, level and bound fields.
+func (l *Logger) Handler() slog.Handler {
+	return &handler{logger: l}
+}
+
+type handler struct {
+	logger *Logger
+	groups []string
+}
+
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(slogLevel(level))
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	properties := make(map[string]any, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(h.target(properties), a)
+		return true
+	})
+
+	_, err := h.logger.print(slogLevel(r.Level), r.Message, properties)
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	properties := make(map[string]any, len(attrs))
+	for _, a := range attrs {
+		addAttr(h.target(properties), a)
+	}
+	return &handler{logger: h.logger.With(properties), groups: h.groups}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := append(append([]string(nil), h.groups...), name)
+	return &handler{logger: h.logger, groups: groups}
+}
+
+// target returns the map that attributes belong in once the handler's
+// groups are applied.
+func (h *handler) target(properties map[string]any) map[string]any {
+	for _, g := range h.groups {
+		nested, ok := properties[g].(map[string]any)
+		if !ok {
+			nested = make(map[string]any)
+			properties[g] = nested
+		}
+		properties = nested
+	}
+	return properties
+}
+
+func addAttr(properties map[string]any, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		target := properties
+		if a.Key != "" {
+			target = make(map[string]any, len(attrs))
+			properties[a.Key] = target
+		}
+		for _, ga := range attrs {
+			addAttr(target, ga)
+		}
+	case slog.KindDuration:
+		properties[a.Key] = a.Value.Duration().String()
+	default:
+		properties[a.Key] = a.Value.Any()
+	}
+}
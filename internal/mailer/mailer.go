@@ -0,0 +1,173 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	ht "html/template"
+	tt "text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends templated emails through an SMTP relay. Each template file
+// defines "subject", "plainBody" and "htmlBody" templates.
+type Mailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	sender   *mail.Address
+	timeout  time.Duration
+}
+
+// New returns a Mailer for the relay at host and port. The sender may
+// include a display name, such as "PSO Resourcing <no-reply@pso.local>".
+func New(host string, port int, username, password, sender string) (Mailer, error) {
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return Mailer{}, fmt.Errorf("mailer: invalid sender %q: %w", sender, err)
+	}
+
+	return Mailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		sender:   from,
+		timeout:  10 * time.Second,
+	}, nil
+}
+
+// Send renders templateFile with data and delivers it to recipient.
+func (m Mailer) Send(recipient, templateFile string, data any) error {
+	msg, err := m.render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	return m.deliver(recipient, msg)
+}
+
+func (m Mailer) render(recipient, templateFile string, data any) ([]byte, error) {
+	tmpl, err := tt.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := ht.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	msg := new(bytes.Buffer)
+	mw := multipart.NewWriter(msg)
+
+	fmt.Fprintf(msg, "From: %s\r\n", m.sender.String())
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		body        *bytes.Buffer
+	}{
+		{"text/plain; charset=utf-8", plainBody},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return msg.Bytes(), nil
+}
+
+// deliver is smtp.SendMail with a connection timeout. STARTTLS is used when
+// the relay offers it, and credentials are only sent when configured.
+func (m Mailer) deliver(recipient string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(3 * m.timeout))
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.sender.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(recipient); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
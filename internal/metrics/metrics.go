@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suitable for an HTTP API.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics and serves them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		reg.mu.Lock()
+		collectors := append([]collector(nil), reg.collectors...)
+		reg.mu.Unlock()
+
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// CounterVec is a monotonically increasing value partitioned by labels.
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]*series
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: make(map[string]*series)}
+	reg.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.name, c.labels, s.labelValues, s.value)
+	}
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by labels.
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	reg.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	labels := append(append([]string(nil), h.labels...), "le")
+
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			values := append(append([]string(nil), s.labelValues...), formatFloat(upper))
+			writeSample(w, h.name+"_bucket", labels, values, float64(s.counts[i]))
+		}
+		values := append(append([]string(nil), s.labelValues...), "+Inf")
+		writeSample(w, h.name+"_bucket", labels, values, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, float64(s.count))
+	}
+}
+
+// GaugeFunc reports the value returned by fn at scrape time.
+type GaugeFunc struct {
+	name, help string
+	kind       string
+	fn         func() float64
+}
+
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(&GaugeFunc{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc is like NewGaugeFunc for values, such as sql.DBStats
+// WaitCount, that only ever increase.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(&GaugeFunc{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, g.kind)
+	writeSample(w, g.name, nil, nil, g.fn())
+}
+
+// helpEscaper and labelEscaper escape text as the Prometheus text format
+// expects, which only knows these escape sequences.
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, labelEscaper.Replace(value))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
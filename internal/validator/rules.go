@@ -0,0 +1,82 @@
+package validator
+
+import (
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// EnumProvider supplies the permitted values for an enumerated field, so the
+// values can come from a static list or from reference data loaded at runtime.
+type EnumProvider interface {
+	Values() []string
+}
+
+type StaticEnum []string
+
+func (e StaticEnum) Values() []string {
+	return e
+}
+
+type EnumFunc func() []string
+
+func (f EnumFunc) Values() []string {
+	return f()
+}
+
+var (
+	registryMu sync.RWMutex
+	enums      = map[string]EnumProvider{}
+	patterns   = map[string]*regexp.Regexp{"email": EmailRX}
+)
+
+// RegisterEnum makes provider available to the enum=<name> struct tag.
+func RegisterEnum(name string, provider EnumProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	enums[name] = provider
+}
+
+// RegisterPattern makes rx available to the pattern=<name> struct tag.
+func RegisterPattern(name string, rx *regexp.Regexp) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	patterns[name] = rx
+}
+
+func lookupEnum(name string) (EnumProvider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	provider, ok := enums[name]
+	return provider, ok
+}
+
+func lookupPattern(name string) (*regexp.Regexp, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	rx, ok := patterns[name]
+	return rx, ok
+}
+
+func Email(value string) bool {
+	return EmailRX.MatchString(value)
+}
+
+func MaxLength(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+func MinLength(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
+func InEnum(value string, provider EnumProvider) bool {
+	return PermittedValue(value, provider.Values()...)
+}
+
+// DateRange reports whether end falls strictly after start. A zero end is
+// treated as an open-ended range.
+func DateRange(start, end time.Time) bool {
+	return end.IsZero() || end.After(start)
+}
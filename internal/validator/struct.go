@@ -0,0 +1,212 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct validates the exported fields of a struct according to their
+// `validate` tags, recursing into nested structs and slices of structs.
+// Errors are recorded against the field's JSON name. Supported rules:
+//
+//	required         value must not be the zero value or empty
+//	min=N, max=N     length of strings and slices, or value of numbers
+//	email            string must be an email address
+//	pattern=name     string must match a pattern added with RegisterPattern
+//	oneof=a|b|c      value must be one of the listed values
+//	enum=name        value must be in an EnumProvider added with RegisterEnum
+//	unique           slice must not contain duplicates
+//	after=Field      time must be after the named sibling field
+func (v *Validator) Struct(s any) {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: Struct called with %s", rv.Kind()))
+	}
+
+	v.validateStruct(rv)
+}
+
+func (v *Validator) validateStruct(rv reflect.Value) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		fv := rv.Field(i)
+		name := jsonName(sf)
+
+		if sf.Anonymous && name == sf.Name {
+			v.validateNested(fv)
+			continue
+		}
+
+		if name == "-" {
+			continue
+		}
+
+		if tag, ok := sf.Tag.Lookup("validate"); ok {
+			for _, rule := range strings.Split(tag, ",") {
+				rule, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+				v.applyRule(rv, fv, name, rule, param)
+			}
+		}
+
+		v.At(name).validateNested(fv)
+	}
+}
+
+func (v *Validator) validateNested(fv reflect.Value) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		if _, isTime := fv.Interface().(time.Time); !isTime {
+			v.validateStruct(fv)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			elem := fv.Index(i)
+			for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct {
+				v.At(i).validateNested(elem)
+			}
+		}
+	}
+}
+
+func (v *Validator) applyRule(parent, fv reflect.Value, key, rule, param string) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			v.CheckCode(rule != "required", key, CodeRequired, "must be provided")
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	switch rule {
+	case "required":
+		ok := !fv.IsZero()
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map {
+			ok = fv.Len() > 0
+		}
+		v.CheckCode(ok, key, CodeRequired, "must be provided")
+	case "min", "max":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validator: invalid %s parameter %q", rule, param))
+		}
+		v.checkBound(fv, key, rule, n)
+	case "email":
+		if s := fv.String(); s != "" {
+			v.CheckCode(Email(s), key, CodeBadFormat, "must be a valid email address")
+		}
+	case "pattern":
+		rx, ok := lookupPattern(param)
+		if !ok {
+			panic(fmt.Sprintf("validator: unknown pattern %q", param))
+		}
+		if s := fv.String(); s != "" {
+			v.CheckCode(Matches(s, rx), key, CodeBadFormat, "is not in the expected format")
+		}
+	case "oneof":
+		values := strings.Split(param, "|")
+		v.CheckCode(PermittedValue(fmt.Sprint(fv.Interface()), values...), key, CodeNotPermitted,
+			fmt.Sprintf("must be one of [%s]", strings.Join(values, ", ")))
+	case "enum":
+		provider, ok := lookupEnum(param)
+		if !ok {
+			panic(fmt.Sprintf("validator: unknown enum %q", param))
+		}
+		values := provider.Values()
+		v.CheckCode(PermittedValue(fmt.Sprint(fv.Interface()), values...), key, CodeNotPermitted,
+			fmt.Sprintf("must be one of [%s]", strings.Join(values, ", ")))
+	case "unique":
+		seen := make(map[any]bool, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			seen[fv.Index(i).Interface()] = true
+		}
+		v.CheckCode(len(seen) == fv.Len(), key, CodeDuplicate, "cannot contain duplicate values")
+	case "after":
+		other := parent.FieldByName(param)
+		if !other.IsValid() {
+			panic(fmt.Sprintf("validator: unknown field %q", param))
+		}
+		end, _ := fv.Interface().(time.Time)
+		start, _ := other.Interface().(time.Time)
+		v.CheckCode(DateRange(start, end), key, CodeOutOfRange, fmt.Sprintf("must be after %s", jsonNameOf(parent.Type(), param)))
+	default:
+		panic(fmt.Sprintf("validator: unknown rule %q", rule))
+	}
+}
+
+func (v *Validator) checkBound(fv reflect.Value, key, rule string, n float64) {
+	var size float64
+	var code, unit string
+
+	switch fv.Kind() {
+	case reflect.String:
+		size = float64(len([]rune(fv.String())))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size = float64(fv.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = fv.Float()
+	default:
+		panic(fmt.Sprintf("validator: %s cannot be applied to %s", rule, fv.Kind()))
+	}
+
+	if rule == "max" {
+		code = CodeOutOfRange
+		if unit != "" {
+			code = CodeTooLong
+		}
+		v.CheckCode(size <= n, key, code, fmt.Sprintf("cannot be more than %s%s", strconv.FormatFloat(n, 'f', -1, 64), unit))
+		return
+	}
+
+	code = CodeOutOfRange
+	if unit != "" {
+		code = CodeTooShort
+	}
+	v.CheckCode(size >= n, key, code, fmt.Sprintf("must be at least %s%s", strconv.FormatFloat(n, 'f', -1, 64), unit))
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func jsonNameOf(t reflect.Type, field string) string {
+	if sf, ok := t.FieldByName(field); ok {
+		return jsonName(sf)
+	}
+	return field
+}
@@ -1,23 +1,122 @@
 package validator
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Codes are stable, machine-readable identifiers for validation failures.
+const (
+	CodeInvalid      = "invalid"
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeTooShort     = "too_short"
+	CodeOutOfRange   = "out_of_range"
+	CodeBadFormat    = "bad_format"
+	CodeNotPermitted = "not_permitted"
+	CodeDuplicate    = "duplicate"
+	CodeNotFound     = "not_found"
+	CodeAmbiguous    = "ambiguous"
+)
+
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// FieldError is a single validation failure. A field may have several.
+type FieldError struct {
+	Path    []any
+	Code    string
+	Message string
+}
+
+// Pointer returns the field's location as a JSON pointer, e.g. /requests/2/skills.
+func (e FieldError) Pointer() string {
+	var sb strings.Builder
+	for _, seg := range e.Path {
+		sb.WriteByte('/')
+		s := fmt.Sprint(seg)
+		s = strings.ReplaceAll(s, "~", "~0")
+		s = strings.ReplaceAll(s, "/", "~1")
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// Key returns the field's location in the dotted form used by the original
+// error envelope, e.g. requests[2].skills.
+func (e FieldError) Key() string {
+	var sb strings.Builder
+	for i, seg := range e.Path {
+		switch seg := seg.(type) {
+		case int:
+			sb.WriteString("[" + strconv.Itoa(seg) + "]")
+		default:
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(fmt.Sprint(seg))
+		}
+	}
+	return sb.String()
+}
 
 type Validator struct {
-	Errors map[string]string
+	errors *[]FieldError
+	path   []any
 }
 
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{errors: &[]FieldError{}}
+}
+
+// At returns a validator that records errors against fields nested under path
+// while sharing its errors with v.
+func (v *Validator) At(path ...any) *Validator {
+	nested := make([]any, 0, len(v.path)+len(path))
+	nested = append(nested, v.path...)
+	nested = append(nested, path...)
+	return &Validator{errors: v.errors, path: nested}
 }
 
 func (v *Validator) Valid() bool {
-	return len(v.Errors) == 0
+	return len(*v.errors) == 0
+}
+
+func (v *Validator) Errors() []FieldError {
+	return *v.errors
+}
+
+// Map returns the first message recorded for each field, keyed as in FieldError.Key.
+func (v *Validator) Map() map[string]string {
+	errs := make(map[string]string, len(*v.errors))
+	for _, e := range *v.errors {
+		if _, exists := errs[e.Key()]; !exists {
+			errs[e.Key()] = e.Message
+		}
+	}
+	return errs
 }
 
 func (v *Validator) AddError(key, message string) {
-	if _, exists := v.Errors[key]; !exists {
-		v.Errors[key] = message
+	v.AddErrorCode(key, CodeInvalid, message)
+}
+
+func (v *Validator) AddErrorCode(key, code, message string) {
+	path := v.path
+	if key != "" {
+		path = append(append([]any{}, v.path...), key)
 	}
+
+	e := FieldError{Path: path, Code: code, Message: message}
+
+	for _, existing := range *v.errors {
+		if existing.Pointer() == e.Pointer() && existing.Message == message {
+			return
+		}
+	}
+
+	*v.errors = append(*v.errors, e)
 }
 
 func (v *Validator) Check(ok bool, key, message string) {
@@ -26,6 +125,12 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+func (v *Validator) CheckCode(ok bool, key, code, message string) {
+	if !ok {
+		v.AddErrorCode(key, code, message)
+	}
+}
+
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS resource_request_comment_search_idx;
+DROP INDEX IF EXISTS resource_request_search_idx;
+DROP INDEX IF EXISTS resource_search_idx;
+DROP INDEX IF EXISTS project_search_idx;
+ALTER TABLE resource_request_comment DROP COLUMN IF EXISTS search;
+ALTER TABLE resource_request DROP COLUMN IF EXISTS search;
+ALTER TABLE resource DROP COLUMN IF EXISTS search;
+ALTER TABLE project DROP COLUMN IF EXISTS search;
+DROP FUNCTION IF EXISTS immutable_array_to_string(text[]);
@@ -0,0 +1,31 @@
+CREATE OR REPLACE FUNCTION immutable_array_to_string(text[]) RETURNS text
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE
+  AS $$ SELECT array_to_string($1, ' ') $$;
+
+ALTER TABLE "project" ADD COLUMN "search" tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', coalesce("name", '')), 'A') ||
+  setweight(to_tsvector('english', coalesce("customer", '')), 'B') ||
+  setweight(to_tsvector('english', coalesce("end_customer", '')), 'B')
+) STORED;
+
+ALTER TABLE "resource" ADD COLUMN "search" tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', coalesce("name", '')), 'A') ||
+  setweight(to_tsvector('english', coalesce(immutable_array_to_string("specialties"), '')), 'B') ||
+  setweight(to_tsvector('english', coalesce(immutable_array_to_string("certifications"), '')), 'C')
+) STORED;
+
+ALTER TABLE "resource_request" ADD COLUMN "search" tsvector GENERATED ALWAYS AS (
+  to_tsvector('english', coalesce(immutable_array_to_string("skills"), ''))
+) STORED;
+
+ALTER TABLE "resource_request_comment" ADD COLUMN "search" tsvector GENERATED ALWAYS AS (
+  to_tsvector('english', coalesce("comment", ''))
+) STORED;
+
+CREATE INDEX "project_search_idx" ON "project" USING GIN ("search");
+
+CREATE INDEX "resource_search_idx" ON "resource" USING GIN ("search");
+
+CREATE INDEX "resource_request_search_idx" ON "resource_request" USING GIN ("search");
+
+CREATE INDEX "resource_request_comment_search_idx" ON "resource_request_comment" USING GIN ("search");
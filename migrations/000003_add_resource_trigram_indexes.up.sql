@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX "resource_name_trgm_idx" ON "resource" USING GIN ("name" gin_trgm_ops);
+
+CREATE INDEX "resource_email_trgm_idx" ON "resource" USING GIN ("email" gin_trgm_ops);
@@ -0,0 +1,28 @@
+CREATE TYPE "job_status" AS ENUM (
+  'queued',
+  'running',
+  'succeeded',
+  'dead'
+);
+
+CREATE TABLE "job" (
+  "job_id" bigserial PRIMARY KEY,
+  "kind" varchar NOT NULL,
+  "payload" jsonb NOT NULL DEFAULT '{}',
+  "status" job_status NOT NULL DEFAULT 'queued',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "max_attempts" integer NOT NULL DEFAULT 5,
+  "run_at" timestamptz NOT NULL DEFAULT now(),
+  "locked_at" timestamptz,
+  "locked_by" varchar,
+  "last_error" text,
+  "unique_key" varchar,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "updated_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "job_ready_idx" ON "job" ("run_at", "job_id") WHERE "status" = 'queued';
+
+CREATE INDEX "job_status_idx" ON "job" ("status", "kind");
+
+CREATE UNIQUE INDEX "job_unique_key_idx" ON "job" ("unique_key");
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS resource_request_event ON resource_request;
+DROP TRIGGER IF EXISTS resource_assignment_event ON resource_assignment;
+DROP FUNCTION IF EXISTS record_request_event();
+DROP FUNCTION IF EXISTS record_assignment_event();
+DROP TABLE IF EXISTS resource_certification;
+DROP TABLE IF EXISTS notification_preference;
+DROP TABLE IF EXISTS notification;
+DROP TABLE IF EXISTS notification_event;
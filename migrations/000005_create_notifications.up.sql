@@ -0,0 +1,80 @@
+CREATE TABLE "notification_event" (
+  "event_id" bigserial PRIMARY KEY,
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "dedupe_key" varchar UNIQUE,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "dispatched_at" timestamptz
+);
+
+CREATE INDEX "notification_event_pending_idx" ON "notification_event" ("event_id") WHERE "dispatched_at" IS NULL;
+
+CREATE TABLE "notification" (
+  "notification_id" bigserial PRIMARY KEY,
+  "event_id" bigint NOT NULL,
+  "employee_id" integer NOT NULL,
+  "recipient" varchar NOT NULL,
+  "template" varchar NOT NULL,
+  "data" jsonb NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "last_error" text,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "sent_at" timestamptz
+);
+
+CREATE TABLE "notification_preference" (
+  "employee_id" integer NOT NULL,
+  "event_type" varchar NOT NULL,
+  "email" boolean NOT NULL,
+  PRIMARY KEY ("employee_id", "event_type")
+);
+
+CREATE TABLE "resource_certification" (
+  "employee_id" integer NOT NULL,
+  "certification" varchar NOT NULL,
+  "expires_on" date,
+  PRIMARY KEY ("employee_id", "certification")
+);
+
+ALTER TABLE "notification" ADD FOREIGN KEY ("event_id") REFERENCES "notification_event" ("event_id");
+
+ALTER TABLE "notification" ADD FOREIGN KEY ("employee_id") REFERENCES "resource" ("employee_id");
+
+ALTER TABLE "notification_preference" ADD FOREIGN KEY ("employee_id") REFERENCES "resource" ("employee_id");
+
+ALTER TABLE "resource_certification" ADD FOREIGN KEY ("employee_id") REFERENCES "resource" ("employee_id");
+
+CREATE FUNCTION "record_assignment_event"() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('assignment.created', row_to_json(NEW));
+  ELSIF TG_OP = 'DELETE' THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('assignment.ended', row_to_json(OLD));
+  ELSIF NEW.end_date IS DISTINCT FROM OLD.end_date AND NEW.end_date <= current_date THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('assignment.ended', row_to_json(NEW));
+  ELSIF NEW IS DISTINCT FROM OLD THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('assignment.changed', row_to_json(NEW));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "resource_assignment_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "resource_assignment"
+  FOR EACH ROW EXECUTE FUNCTION record_assignment_event();
+
+CREATE FUNCTION "record_request_event"() RETURNS trigger AS $$
+BEGIN
+  IF (TG_OP = 'INSERT' OR NEW.status IS DISTINCT FROM OLD.status) AND NEW.status = 'Open' THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('request.opened', row_to_json(NEW));
+  ELSIF TG_OP = 'UPDATE' AND NEW.status IS DISTINCT FROM OLD.status AND NEW.status = 'Closed' THEN
+    INSERT INTO notification_event (event_type, payload) VALUES ('request.closed', row_to_json(NEW));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "resource_request_event"
+  AFTER INSERT OR UPDATE ON "resource_request"
+  FOR EACH ROW EXECUTE FUNCTION record_request_event();
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS resource_assignment_webhook_event ON resource_assignment;
+DROP TRIGGER IF EXISTS resource_request_comment_webhook_event ON resource_request_comment;
+DROP TRIGGER IF EXISTS resource_request_webhook_event ON resource_request;
+DROP TRIGGER IF EXISTS resource_webhook_event ON resource;
+DROP TRIGGER IF EXISTS project_webhook_event ON project;
+DROP FUNCTION IF EXISTS record_webhook_event();
+DROP TABLE IF EXISTS webhook_delivery;
+DROP TABLE IF EXISTS webhook_event;
+DROP TABLE IF EXISTS webhook;
@@ -0,0 +1,68 @@
+CREATE TABLE "webhook" (
+  "webhook_id" bigserial PRIMARY KEY,
+  "url" varchar NOT NULL,
+  "secret" varchar NOT NULL,
+  "event_types" text[] NOT NULL,
+  "active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  "version" integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE "webhook_event" (
+  "event_id" bigserial PRIMARY KEY,
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "dispatched_at" timestamptz
+);
+
+CREATE INDEX "webhook_event_pending_idx" ON "webhook_event" ("event_id") WHERE "dispatched_at" IS NULL;
+
+CREATE TABLE "webhook_delivery" (
+  "delivery_id" bigserial PRIMARY KEY,
+  "webhook_id" bigint NOT NULL REFERENCES "webhook" ("webhook_id") ON DELETE CASCADE,
+  "event_id" bigint NOT NULL REFERENCES "webhook_event" ("event_id"),
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "response_status" integer,
+  "error" text,
+  "duration_ms" integer,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "attempted_at" timestamptz
+);
+
+CREATE INDEX "webhook_delivery_webhook_idx" ON "webhook_delivery" ("webhook_id", "delivery_id");
+
+CREATE FUNCTION "record_webhook_event"() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO webhook_event (event_type, payload) VALUES (TG_ARGV[0] || '.created', row_to_json(NEW));
+  ELSIF TG_OP = 'DELETE' THEN
+    INSERT INTO webhook_event (event_type, payload) VALUES (TG_ARGV[0] || '.deleted', row_to_json(OLD));
+  ELSIF NEW IS DISTINCT FROM OLD THEN
+    INSERT INTO webhook_event (event_type, payload) VALUES (TG_ARGV[0] || '.updated', row_to_json(NEW));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "project_webhook_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "project"
+  FOR EACH ROW EXECUTE FUNCTION record_webhook_event('project');
+
+CREATE TRIGGER "resource_webhook_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "resource"
+  FOR EACH ROW EXECUTE FUNCTION record_webhook_event('resource');
+
+CREATE TRIGGER "resource_request_webhook_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "resource_request"
+  FOR EACH ROW EXECUTE FUNCTION record_webhook_event('request');
+
+CREATE TRIGGER "resource_request_comment_webhook_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "resource_request_comment"
+  FOR EACH ROW EXECUTE FUNCTION record_webhook_event('comment');
+
+CREATE TRIGGER "resource_assignment_webhook_event"
+  AFTER INSERT OR UPDATE OR DELETE ON "resource_assignment"
+  FOR EACH ROW EXECUTE FUNCTION record_webhook_event('assignment');
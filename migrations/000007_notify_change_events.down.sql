@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS webhook_event_notify ON webhook_event;
+DROP FUNCTION IF EXISTS notify_change_event();
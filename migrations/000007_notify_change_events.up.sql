@@ -0,0 +1,10 @@
+CREATE FUNCTION "notify_change_event"() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('change_event', NEW.event_id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "webhook_event_notify"
+  AFTER INSERT ON "webhook_event"
+  FOR EACH ROW EXECUTE FUNCTION notify_change_event();
@@ -0,0 +1,8 @@
+CREATE TABLE "roster_reconciliation" (
+  "reconciliation_id" bigserial PRIMARY KEY,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "report" jsonb NOT NULL,
+  "result" jsonb,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "confirmed_at" timestamptz
+);
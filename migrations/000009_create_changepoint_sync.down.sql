@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS changepoint_baseline;
+DROP TABLE IF EXISTS project_sync_flag;
+DROP TABLE IF EXISTS project_sync;
+DROP TABLE IF EXISTS changepoint_sync;
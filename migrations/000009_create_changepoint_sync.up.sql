@@ -0,0 +1,46 @@
+CREATE TABLE "changepoint_sync" (
+  "sync_id" bigserial PRIMARY KEY,
+  "source" varchar NOT NULL,
+  "row_count" integer NOT NULL,
+  "updated" integer NOT NULL,
+  "unchanged" integer NOT NULL,
+  "flagged" integer NOT NULL,
+  "unmatched" integer NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE "project_sync" (
+  "entry_id" bigserial PRIMARY KEY,
+  "sync_id" bigint NOT NULL REFERENCES "changepoint_sync" ON DELETE CASCADE,
+  "opportunity_id" varchar REFERENCES "project" ON DELETE CASCADE,
+  "changepoint_id" varchar,
+  "line" integer NOT NULL,
+  "outcome" varchar NOT NULL,
+  "changes" jsonb NOT NULL,
+  "note" text,
+  "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "project_sync_sync_idx" ON "project_sync" ("sync_id", "entry_id");
+CREATE INDEX "project_sync_project_idx" ON "project_sync" ("opportunity_id", "entry_id");
+
+CREATE TABLE "project_sync_flag" (
+  "flag_id" bigserial PRIMARY KEY,
+  "sync_id" bigint NOT NULL REFERENCES "changepoint_sync" ON DELETE CASCADE,
+  "opportunity_id" varchar NOT NULL REFERENCES "project" ON DELETE CASCADE,
+  "field" varchar NOT NULL,
+  "local_value" varchar NOT NULL,
+  "changepoint_value" varchar NOT NULL,
+  "note" text,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "resolved_at" timestamptz
+);
+
+CREATE UNIQUE INDEX "project_sync_flag_pending_idx" ON "project_sync_flag" ("opportunity_id", "field") WHERE "status" = 'pending';
+
+CREATE TABLE "changepoint_baseline" (
+  "opportunity_id" varchar PRIMARY KEY REFERENCES "project" ON DELETE CASCADE,
+  "fields" jsonb NOT NULL,
+  "synced_at" timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS resource_certification_sync ON resource;
+DROP FUNCTION IF EXISTS sync_resource_certifications();
@@ -0,0 +1,22 @@
+INSERT INTO "resource_certification" ("employee_id", "certification")
+SELECT DISTINCT "employee_id", unnest("certifications")
+FROM "resource"
+ON CONFLICT DO NOTHING;
+
+CREATE FUNCTION "sync_resource_certifications"() RETURNS trigger AS $$
+BEGIN
+  DELETE FROM resource_certification
+  WHERE employee_id = NEW.employee_id
+  AND NOT (certification = ANY(coalesce(NEW.certifications, '{}')));
+
+  INSERT INTO resource_certification (employee_id, certification)
+  SELECT DISTINCT NEW.employee_id, unnest(NEW.certifications)
+  ON CONFLICT DO NOTHING;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "resource_certification_sync"
+  AFTER INSERT OR UPDATE OF "certifications" ON "resource"
+  FOR EACH ROW EXECUTE FUNCTION sync_resource_certifications();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS webhook_event_txid_idx;
+ALTER TABLE webhook_event DROP COLUMN IF EXISTS txid;
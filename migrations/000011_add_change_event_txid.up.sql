@@ -0,0 +1,3 @@
+ALTER TABLE "webhook_event" ADD COLUMN "txid" xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX "webhook_event_txid_idx" ON "webhook_event" ("txid", "event_id");
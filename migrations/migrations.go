@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Latest returns the highest migration version in this directory, which is
+// the schema version the running code expects.
+func Latest() int {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return 0
+	}
+
+	latest := 0
+	for _, e := range entries {
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		if v, err := strconv.Atoi(prefix); err == nil && v > latest {
+			latest = v
+		}
+	}
+	return latest
+}